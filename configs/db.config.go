@@ -25,7 +25,7 @@ func InitDatabase(env *DBConfig) {
 	var err error
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai", env.Host, env.User, env.Pass, env.Name, env.Port)
 
-	dbConnection, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	dbConnection, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true}) // unique violations come back as gorm.ErrDuplicatedKey
 	if err != nil {
 		log.Fatal("Failed to connect to the Database! \n", err.Error())
 		os.Exit(1)
@@ -34,7 +34,7 @@ func InitDatabase(env *DBConfig) {
 	dbConnection.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
 
 	log.Println("Running Migrations")
-	err = dbConnection.AutoMigrate(&models.Account{}, &models.UserLogin{}, &models.UserOtp{}, &models.Address{})
+	err = dbConnection.AutoMigrate(&models.Account{}, &models.UserLogin{}, &models.UserOtp{}, &models.Address{}, &models.AccountTwoFactor{}, &models.TwoFactorRecoveryCode{}, &models.Role{}, &models.Permission{}, &models.AccountRole{}, &models.AccountBlockEvent{}, &models.MobileChangeRequest{}, &models.AuthEvent{}, &models.DataExport{}, &models.AccountPreference{}, &models.UsedToken{})
 	if err != nil {
 		log.Fatal("Migration Failed:  \n", err.Error())
 		os.Exit(1)
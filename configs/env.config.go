@@ -8,14 +8,66 @@ import (
 )
 
 type EnvConfig struct {
-	DB_HOST          string
-	DB_PORT          string
-	DB_NAME          string
-	DB_USER          string
-	DB_PASS          string
-	JWT_SECRET_KEY   string
-	GO_ENV           string
-	MEMECACHE_SERVER string
+	DB_HOST                   string
+	DB_PORT                   string
+	DB_NAME                   string
+	DB_USER                   string
+	DB_PASS                   string
+	JWT_SECRET_KEY            string
+	JWT_ISSUER                string
+	JWT_AUDIENCE              string
+	JWT_KEYS_DIR              string
+	JWT_SIGNING_KEY_ID        string
+	GO_ENV                    string
+	MEMECACHE_SERVER          string
+	OTP_DRIVER                string
+	OTP_LENGTH                string
+	OTP_SPOOL_FILE            string
+	OTP_MAX_ATTEMPTS          string
+	OTP_MAX_SENDS             string
+	OTP_SEND_WINDOW           string
+	OTP_COOLDOWN              string
+	OTP_LOCKOUT               string
+	OTP_HASH_SECRET           string
+	GOOGLE_CLIENT_IDS         string
+	GOOGLE_JWKS_URL           string
+	APPLE_CLIENT_IDS          string
+	APPLE_JWKS_URL            string
+	PASSWORD_RESET_URL        string
+	TOTP_ISSUER               string
+	ADMIN_ACCOUNT_IDS         string
+	EMAIL_LOGIN_URL           string
+	EMAIL_DRIVER              string
+	EMAIL_FROM                string
+	EMAIL_MAILDIR             string
+	EMAIL_MAX_ATTEMPTS        string
+	SMTP_HOST                 string
+	SMTP_PORT                 string
+	SMTP_USERNAME             string
+	SMTP_PASSWORD             string
+	EMAIL_VERIFY_URL          string
+	EMAIL_VERIFY_REDIRECT_URL string
+	PUSH_DRIVER               string
+	PUSH_SPOOL_FILE           string
+	SESSION_REVOKE_URL        string
+	ACCOUNT_DELETION_GRACE    string
+	ACCOUNT_DELETION_INTERVAL string
+	URL_SIGNING_SECRET        string
+	DATA_EXPORT_DIR           string
+	DATA_EXPORT_TTL           string
+	DATA_EXPORT_URL           string
+	STORAGE_DRIVER            string
+	STORAGE_LOCAL_DIR         string
+	STORAGE_URL               string
+	STORAGE_URL_TTL           string
+	S3_ENDPOINT               string
+	S3_REGION                 string
+	S3_BUCKET                 string
+	S3_ACCESS_KEY             string
+	S3_SECRET_KEY             string
+	S3_PATH_STYLE             string
+	JWT_ACCEPT_LEGACY_HS256   string
+	TWO_FACTOR_SECRET         string
 }
 
 func AppEnv() EnvConfig {
@@ -27,14 +79,66 @@ func AppEnv() EnvConfig {
 	}
 
 	return EnvConfig{
-		DB_HOST:          os.Getenv("POSTGRES_HOST"),
-		DB_PORT:          os.Getenv("POSTGRES_PORT"),
-		DB_NAME:          os.Getenv("POSTGRES_DB"),
-		DB_USER:          os.Getenv("POSTGRES_USER"),
-		DB_PASS:          os.Getenv("POSTGRES_PASSWORD"),
-		JWT_SECRET_KEY:   os.Getenv("JWT_SECRET_KEY"),
-		GO_ENV:           os.Getenv("GO_ENV"),
-		MEMECACHE_SERVER: os.Getenv("MEMECACHE_SERVER"),
+		DB_HOST:                   os.Getenv("POSTGRES_HOST"),
+		DB_PORT:                   os.Getenv("POSTGRES_PORT"),
+		DB_NAME:                   os.Getenv("POSTGRES_DB"),
+		DB_USER:                   os.Getenv("POSTGRES_USER"),
+		DB_PASS:                   os.Getenv("POSTGRES_PASSWORD"),
+		JWT_SECRET_KEY:            os.Getenv("JWT_SECRET_KEY"),
+		JWT_ISSUER:                os.Getenv("JWT_ISSUER"),
+		JWT_AUDIENCE:              os.Getenv("JWT_AUDIENCE"),
+		JWT_KEYS_DIR:              os.Getenv("JWT_KEYS_DIR"),
+		JWT_SIGNING_KEY_ID:        os.Getenv("JWT_SIGNING_KEY_ID"),
+		GO_ENV:                    os.Getenv("GO_ENV"),
+		MEMECACHE_SERVER:          os.Getenv("MEMECACHE_SERVER"),
+		OTP_DRIVER:                os.Getenv("OTP_DRIVER"),
+		OTP_LENGTH:                os.Getenv("OTP_LENGTH"),
+		OTP_SPOOL_FILE:            os.Getenv("OTP_SPOOL_FILE"),
+		OTP_MAX_ATTEMPTS:          os.Getenv("OTP_MAX_ATTEMPTS"),
+		OTP_MAX_SENDS:             os.Getenv("OTP_MAX_SENDS"),
+		OTP_SEND_WINDOW:           os.Getenv("OTP_SEND_WINDOW"),
+		OTP_COOLDOWN:              os.Getenv("OTP_COOLDOWN"),
+		OTP_LOCKOUT:               os.Getenv("OTP_LOCKOUT"),
+		OTP_HASH_SECRET:           os.Getenv("OTP_HASH_SECRET"),
+		GOOGLE_CLIENT_IDS:         os.Getenv("GOOGLE_CLIENT_IDS"),
+		GOOGLE_JWKS_URL:           os.Getenv("GOOGLE_JWKS_URL"),
+		APPLE_CLIENT_IDS:          os.Getenv("APPLE_CLIENT_IDS"),
+		APPLE_JWKS_URL:            os.Getenv("APPLE_JWKS_URL"),
+		PASSWORD_RESET_URL:        os.Getenv("PASSWORD_RESET_URL"),
+		TOTP_ISSUER:               os.Getenv("TOTP_ISSUER"),
+		ADMIN_ACCOUNT_IDS:         os.Getenv("ADMIN_ACCOUNT_IDS"),
+		EMAIL_LOGIN_URL:           os.Getenv("EMAIL_LOGIN_URL"),
+		EMAIL_DRIVER:              os.Getenv("EMAIL_DRIVER"),
+		EMAIL_FROM:                os.Getenv("EMAIL_FROM"),
+		EMAIL_MAILDIR:             os.Getenv("EMAIL_MAILDIR"),
+		EMAIL_MAX_ATTEMPTS:        os.Getenv("EMAIL_MAX_ATTEMPTS"),
+		SMTP_HOST:                 os.Getenv("SMTP_HOST"),
+		SMTP_PORT:                 os.Getenv("SMTP_PORT"),
+		SMTP_USERNAME:             os.Getenv("SMTP_USERNAME"),
+		SMTP_PASSWORD:             os.Getenv("SMTP_PASSWORD"),
+		EMAIL_VERIFY_URL:          os.Getenv("EMAIL_VERIFY_URL"),
+		EMAIL_VERIFY_REDIRECT_URL: os.Getenv("EMAIL_VERIFY_REDIRECT_URL"),
+		PUSH_DRIVER:               os.Getenv("PUSH_DRIVER"),
+		PUSH_SPOOL_FILE:           os.Getenv("PUSH_SPOOL_FILE"),
+		SESSION_REVOKE_URL:        os.Getenv("SESSION_REVOKE_URL"),
+		ACCOUNT_DELETION_GRACE:    os.Getenv("ACCOUNT_DELETION_GRACE"),
+		ACCOUNT_DELETION_INTERVAL: os.Getenv("ACCOUNT_DELETION_INTERVAL"),
+		URL_SIGNING_SECRET:        os.Getenv("URL_SIGNING_SECRET"),
+		DATA_EXPORT_DIR:           os.Getenv("DATA_EXPORT_DIR"),
+		DATA_EXPORT_TTL:           os.Getenv("DATA_EXPORT_TTL"),
+		DATA_EXPORT_URL:           os.Getenv("DATA_EXPORT_URL"),
+		STORAGE_DRIVER:            os.Getenv("STORAGE_DRIVER"),
+		STORAGE_LOCAL_DIR:         os.Getenv("STORAGE_LOCAL_DIR"),
+		STORAGE_URL:               os.Getenv("STORAGE_URL"),
+		STORAGE_URL_TTL:           os.Getenv("STORAGE_URL_TTL"),
+		S3_ENDPOINT:               os.Getenv("S3_ENDPOINT"),
+		S3_REGION:                 os.Getenv("S3_REGION"),
+		S3_BUCKET:                 os.Getenv("S3_BUCKET"),
+		S3_ACCESS_KEY:             os.Getenv("S3_ACCESS_KEY"),
+		S3_SECRET_KEY:             os.Getenv("S3_SECRET_KEY"),
+		S3_PATH_STYLE:             os.Getenv("S3_PATH_STYLE"),
+		JWT_ACCEPT_LEGACY_HS256:   os.Getenv("JWT_ACCEPT_LEGACY_HS256"),
+		TWO_FACTOR_SECRET:         os.Getenv("TWO_FACTOR_SECRET"),
 	}
 
 }
@@ -1,6 +1,7 @@
 package configs
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
@@ -32,6 +33,29 @@ func (m *MemcacheClient) Get(key string) ([]byte, error) {
 	return item.Value, nil
 }
 
+// Increment adds delta to a counter. A missing counter is created with the given expiration,
+// so the expiration marks the end of a fixed window.
+func (m *MemcacheClient) Increment(key string, delta uint64, expiration time.Duration) (uint64, error) {
+	value, err := m.client.Increment(key, delta)
+	if err != memcache.ErrCacheMiss {
+		return value, err
+	}
+
+	err = m.client.Add(&memcache.Item{
+		Key:        key,
+		Value:      []byte(strconv.FormatUint(delta, 10)),
+		Expiration: int32(expiration.Seconds()),
+	})
+	if err == memcache.ErrNotStored {
+		// Someone else created the counter in the meantime
+		return m.client.Increment(key, delta)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return delta, nil
+}
+
 func (m *MemcacheClient) Delete(key string) error {
 	return m.client.Delete(key)
 }
@@ -12,28 +12,32 @@ import (
 )
 
 type AccountRegistrationPayload struct {
-	Mobile      string `json:"mobile" validate:"required,number,max=10,min=10"`
-	CountryCode string `json:"country_code" validate:"required,max=3"`
+	Mobile      string `json:"mobile" validate:"required,max=20"`
+	CountryCode string `json:"country_code" validate:"required,max=4"`
 	Fcm         string `json:"fcm" validate:"required"`
 	Platform    string `json:"platform" validate:"required"`
 	Language    string `json:"language"`
 }
 type ResendVerificationOTPPayload struct {
-	Mobile string `json:"mobile" validate:"required,number,max=10,min=10"`
+	Mobile      string `json:"mobile" validate:"required,max=20"`
+	CountryCode string `json:"country_code" validate:"omitempty,max=4"`
 }
 type VerifyAccountPayload struct {
-	Mobile string `json:"mobile" validate:"required,number,max=10,min=10"`
-	Otp    string `json:"otp" validate:"required"`
-	Fcm    string `json:"fcm" validate:"required"`
+	Mobile      string `json:"mobile" validate:"required,max=20"`
+	CountryCode string `json:"country_code" validate:"omitempty,max=4"`
+	Otp         string `json:"otp" validate:"required"`
+	Fcm         string `json:"fcm" validate:"required"`
 }
 type LoginPayload struct {
-	Mobile string `json:"mobile" validate:"required,number,max=10,min=10"`
+	Mobile      string `json:"mobile" validate:"required,max=20"`
+	CountryCode string `json:"country_code" validate:"omitempty,max=4"`
 }
 type LoginVerifyPayload struct {
-	Mobile   string `json:"mobile" validate:"required,number,max=10,min=10"`
-	Otp      string `json:"otp" validate:"required"`
-	FCM      string `json:"fcm" validate:"required"`
-	Platform string `json:"platform" validate:"required"`
+	Mobile      string `json:"mobile" validate:"required,max=20"`
+	CountryCode string `json:"country_code" validate:"omitempty,max=4"`
+	Otp         string `json:"otp" validate:"required"`
+	FCM         string `json:"fcm" validate:"required"`
+	Platform    string `json:"platform" validate:"required"`
 }
 type GenerateAccessTokenPayload struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
@@ -51,6 +55,14 @@ func Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err, "success": false})
 	}
 
+	phone, err := helpers.ParsePhone(payload.Mobile, payload.CountryCode)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	payload.Mobile = phone.E164()
+
 	db := configs.DB
 
 	user := models.Account{}
@@ -64,7 +76,7 @@ func Register(c *fiber.Ctx) error {
 
 	newUser := models.Account{
 		Mobile:      payload.Mobile,
-		CountryCode: payload.CountryCode,
+		CountryCode: phone.CountryCode,
 	}
 
 	// Create user
@@ -95,24 +107,11 @@ func Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
 	}
 
-	// Generate OTP
-	otp := helpers.GenerateOtp()
+	recordAuthEvent(c, models.AuthEvent{AccountID: newUser.ID, Type: models.AuthEventRegister}, &userLogin)
 
-	// This is the first time it will be created after registration after we only need to update the OTP table
-	createOtp := db.Create(&models.UserOtp{
-		AccountID:       newUser.ID,
-		Otp:             otp,
-		ExpiredDateTime: time.Now().Add(10 * time.Minute), // 10 minutes
-	})
-
-	if createOtp.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
-	}
-
-	err := helpers.SendOTP(otp, newUser.Mobile)
-
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to send OTP", "success": false})
+	// The OTP row is created with the first code, after that we only need to update it
+	if err := sendAccountOtp(c, &newUser, 10*time.Minute); err != nil {
+		return otpErrorResponse(c, err)
 	}
 
 	// Return response
@@ -131,6 +130,14 @@ func ResendVerificationOtp(c *fiber.Ctx) error {
 
 	}
 
+	phone, err := helpers.ParsePhone(payload.Mobile, payload.CountryCode)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	payload.Mobile = phone.E164()
+
 	db := configs.DB
 
 	user := models.Account{}
@@ -149,38 +156,16 @@ func ResendVerificationOtp(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "User is already verified. Please login!", "success": false})
 	}
 
-	if user.IsBlacklisted {
+	if user.BlacklistActive() {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "User is blacklisted. Please contact support!", "success": false})
 	}
 
-	if user.IsBlocked {
+	if user.BlockActive() {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "User is blocked. Please contact support!", "success": false})
 	}
 
-	// Generate OTP
-	otp := helpers.GenerateOtp()
-
-	userOtp := models.UserOtp{}
-
-	createOtp := db.FirstOrCreate(&userOtp, models.UserOtp{AccountID: user.ID})
-
-	if createOtp.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
-	}
-
-	userOtp.Otp = otp
-	userOtp.ExpiredDateTime = time.Now().Add(5 * time.Minute)
-
-	result := db.Save(&userOtp)
-
-	if result.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
-	}
-
-	err := helpers.SendOTP(otp, user.Mobile)
-
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to send OTP", "success": false})
+	if err := sendAccountOtp(c, &user, 5*time.Minute); err != nil {
+		return otpErrorResponse(c, err)
 	}
 
 	// Return response
@@ -199,6 +184,14 @@ func VerifyAccountRegistration(c *fiber.Ctx) error {
 
 	}
 
+	phone, err := helpers.ParsePhone(payload.Mobile, payload.CountryCode)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	payload.Mobile = phone.E164()
+
 	db := configs.DB
 
 	user := models.Account{}
@@ -217,11 +210,11 @@ func VerifyAccountRegistration(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "User is already verified. Please login!", "success": false})
 	}
 
-	if user.IsBlacklisted {
+	if user.BlacklistActive() {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "User is blacklisted. Please contact support!", "success": false})
 	}
 
-	if user.IsBlocked {
+	if user.BlockActive() {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "User is blocked. Please contact support!", "success": false})
 	}
 
@@ -233,28 +226,8 @@ func VerifyAccountRegistration(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "You are tried to login from different device than registered account. Please use registered device!", "success": false})
 	}
 
-	otpModel := models.UserOtp{}
-
-	otpResult := db.First(&otpModel, "account_id = ?", user.ID)
-
-	if otpResult.RowsAffected == 0 {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "No OTP found", "success": false})
-	}
-
-	if otpResult.Error != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": otpResult.Error.Error(), "success": false})
-	}
-
-	if otpModel.IsExpired {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "OTP Expired!", "success": false})
-	}
-
-	if otpModel.ExpiredDateTime.UnixMilli() < time.Now().UnixMilli() {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "OTP Expired!", "success": false})
-	}
-
-	if otpModel.Otp != payload.Otp {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid OTP!", "success": false})
+	if err := verifyAccountOtp(c, &user, payload.Otp); err != nil {
+		return otpErrorResponse(c, err)
 	}
 
 	userUpdate := models.Account{}
@@ -280,9 +253,17 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
 	}
 
+	phone, err := helpers.ParsePhone(payload.Mobile, payload.CountryCode)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	payload.Mobile = phone.E164()
+
 	db := configs.DB
 	userExist := models.Account{}
-	result := db.First(&userExist, "mobile = ?", strings.ToLower(payload.Mobile))
+	result := db.First(&userExist, "mobile = ?", payload.Mobile)
 
 	if result.Error != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
@@ -292,39 +273,18 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Account does not exist. Please register!", "success": false})
 	}
 
-	if userExist.IsBlocked {
+	if userExist.BlockActive() {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
 	}
-	if userExist.IsBlacklisted {
+	if userExist.BlacklistActive() {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
 	}
 	if !userExist.IsMobileVerified {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You are not verified! Please verify your account!", "data": fiber.Map{"id": userExist.ID, "isMobileVerified": userExist.IsMobileVerified}, "success": false})
 	}
 
-	// Generate OTP
-	otp := helpers.GenerateOtp()
-
-	userOtp := models.UserOtp{}
-
-	createOtp := db.FirstOrCreate(&userOtp, models.UserOtp{AccountID: userExist.ID})
-
-	if createOtp.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
-	}
-
-	userOtp.Otp = otp
-	userOtp.ExpiredDateTime = time.Now().Add(5 * time.Minute)
-	userOtp.IsExpired = false
-
-	if err := createOtp.Save(&userOtp).Error; err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
-	}
-
-	err := helpers.SendOTP(otp, userExist.Mobile)
-
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to send OTP", "success": false})
+	if err := sendAccountOtp(c, &userExist, 5*time.Minute); err != nil {
+		return otpErrorResponse(c, err)
 	}
 
 	// Return response
@@ -343,9 +303,17 @@ func LoginVerifyOTP(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
 	}
 
+	phone, err := helpers.ParsePhone(payload.Mobile, payload.CountryCode)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	payload.Mobile = phone.E164()
+
 	db := configs.DB
 	userExist := models.Account{}
-	result := db.First(&userExist, "mobile = ?", strings.ToLower(payload.Mobile))
+	result := db.First(&userExist, "mobile = ?", payload.Mobile)
 
 	if result.RowsAffected == 0 {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Account does not exist. Please register!", "success": false})
@@ -355,77 +323,22 @@ func LoginVerifyOTP(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
 	}
 
-	if userExist.IsBlocked {
+	if userExist.BlockActive() {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
 	}
-	if userExist.IsBlacklisted {
+	if userExist.BlacklistActive() {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
 	}
 	if !userExist.IsMobileVerified {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You are not verified! Please verify your account!", "success": false})
 	}
 
-	//find user otp and match the otp
-	userOtp := models.UserOtp{}
-	result = db.First(&userOtp, "account_id = ? AND otp = ?", userExist.ID, payload.Otp)
-
-	if result.RowsAffected == 0 {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Invalid OTP. Please try again!", "success": false})
-	}
-
-	if result.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
-	}
-
-	if userOtp.IsExpired {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "OTP has expired. Please try again!", "success": false})
-	}
-
-	if time.Now().After(userOtp.ExpiredDateTime) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "OTP has expired. Please try again!", "success": false})
-	}
-
-	userOtp.IsExpired = true
-	db.Save(&userOtp)
-
-	userLogin := models.UserLogin{}
-
-	refreshToken, err := helpers.GenerateToken(helpers.TokenClaims{
-		UserId: userExist.ID,
-		Exp:    time.Now().Add(time.Hour * 168).Unix(), // 7 days
-	})
-
-	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
-	}
-
-	userLoginUpdate := db.FirstOrCreate(&userLogin, models.UserLogin{AccountID: userExist.ID, FCM: payload.FCM, Platform: payload.Platform})
-
-	if userLoginUpdate.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
-	}
-
-	userExist.IsLoggedIn = true
-	db.Save(&userExist)
-
-	userLogin.RefreshToken = refreshToken
-	userLogin.IsActive = true
-	db.Save(&userLogin)
-
-	//update other login of the same platform with is_active = false
-	db.Model(&models.UserLogin{}).Where("id != ? AND account_id = ? AND platform = ? AND is_active = ?", userLogin.ID, userExist.ID, payload.Platform, true).Update("is_active", false)
-
-	accessToken, err := helpers.GenerateToken(helpers.TokenClaims{
-		UserId: userExist.ID,
-		Exp:    time.Now().Add(time.Hour * 24).Unix(), // 1 day
-	})
-
-	if err != nil {
-		log.Printf("Error generating access token: %v", err)
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
+	//match the otp, this also spends it
+	if err := verifyAccountOtp(c, &userExist, payload.Otp); err != nil {
+		return otpErrorResponse(c, err)
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User successfully logged in", "data": fiber.Map{"accessToken": accessToken, "refreshToken": refreshToken, "user": fiber.Map{"id": userExist.ID, "name": userExist.Name, "email": userExist.Email}}, "success": true})
+	return loginUser(c, &userExist, payload.FCM, payload.Platform)
 
 }
 func GenerateToken(c *fiber.Ctx) error {
@@ -440,7 +353,7 @@ func GenerateToken(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
 	}
 
-	validToken, err := helpers.ParseToken(payload.RefreshToken)
+	validToken, err := helpers.ParseToken(payload.RefreshToken, helpers.TokenTypeRefresh)
 
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
@@ -450,53 +363,57 @@ func GenerateToken(c *fiber.Ctx) error {
 
 	db := configs.DB
 	user := models.Account{}
-	result := db.Select("is_blocked", "id", "role", "valid_logged_in_at").First(&user, "id = ?", userId)
+	result := db.Select("is_blocked", "blocked_until", "is_blacklisted", "blacklisted_until", "id").First(&user, "id = ?", userId)
 
 	if result.Error != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
 	}
 
-	if user.IsBlocked {
+	if user.BlockActive() {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
 	}
 
-	if !user.IsBlacklisted {
+	if user.BlacklistActive() {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
 	}
 
-	accessToken, err := helpers.GenerateToken(helpers.TokenClaims{
-		UserId: user.ID,
-		Exp:    time.Now().Add(time.Hour * 24).Unix(), // 1 day
-	})
+	accessToken, refreshToken, ok, err := rotateRefreshToken(&user, validToken, payload.RefreshToken)
 
 	if err != nil {
+		log.Printf("Error rotating refresh token: %v", err)
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Please login", "success": false})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Token successfully generated", "data": fiber.Map{"accessToken": accessToken}, "success": true})
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
+	}
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventTokenRefresh, SessionID: validToken.SessionId}, nil)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Token successfully generated", "data": fiber.Map{"accessToken": accessToken, "refreshToken": refreshToken}, "success": true})
 
 }
 func LogoutUser(c *fiber.Ctx) error {
 
-	userId := c.Locals("userId")
+	sessionId := c.Locals("sessionId")
 
 	db := configs.DB
-	user := models.Account{}
-	result := db.Select("id").First(&user, "id = ?", userId)
+	user := currentAccount(c)
 
-	if result.Error != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
+	if err := revokeSessions(db.Where("id = ? AND account_id = ?", sessionId, user.ID)); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't logged out user", "success": false})
 	}
 
-	updateUsers := models.Account{
-		IsLoggedIn: false,
-	}
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventLogout}, nil)
 
-	if err := db.Model(&user).Updates(updateUsers).Error; err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't logged out user", "success": false})
-	}
+	var activeSessions int64
+	db.Model(&models.UserLogin{}).Where("account_id = ? AND is_active = ?", user.ID, true).Count(&activeSessions)
 
-	db.Model(&models.UserLogin{}).Where("account_id = ?", user.ID).Update("is_active", false)
+	if activeSessions == 0 {
+		if err := db.Model(user).Update("is_logged_in", false).Error; err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't logged out user", "success": false})
+		}
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User successfully logged out", "success": true})
 
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuthEventQuery struct {
+	Limit     int    `json:"limit" validate:"omitempty,number,min=1,max=100"`
+	Page      int    `json:"page" validate:"omitempty,number,min=1"`
+	Type      string `json:"type" validate:"omitempty,max=30"`
+	AccountID string `query:"account_id" json:"account_id" validate:"omitempty,uuid"`
+	IP        string `json:"ip" validate:"omitempty,ip"`
+	From      string `json:"from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To        string `json:"to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+}
+
+// GetSecurityEvents lists the security history of the signed in account.
+func GetSecurityEvents(c *fiber.Ctx) error {
+
+	var payload AuthEventQuery
+
+	if err := c.QueryParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	// Users only ever see their own history
+	payload.AccountID = c.Locals("userId").(string)
+
+	events, total, err := findAuthEvents(payload)
+
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching security events", "success": false})
+	}
+
+	sessionId := c.Locals("sessionId")
+	data := make([]fiber.Map, 0, len(events))
+
+	for _, event := range events {
+		data = append(data, fiber.Map{
+			"id":         event.ID,
+			"type":       event.Type,
+			"detail":     event.Detail,
+			"ip":         event.IP,
+			"user_agent": event.UserAgent,
+			"platform":   event.Platform,
+			"by_admin":   event.ActorID != "",
+			"current":    event.SessionID != 0 && event.SessionID == sessionId,
+			"created_at": event.CreatedAt,
+		})
+	}
+
+	limit, page := pageOrDefault(PageQuery{Limit: payload.Limit, Page: payload.Page})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Security events fetched successfully", "data": data, "count": len(data), "total": total, "page": page, "limit": limit, "success": true})
+}
+
+// SearchAuthEvents lets admins search the security history across accounts.
+func SearchAuthEvents(c *fiber.Ctx) error {
+
+	var payload AuthEventQuery
+
+	if err := c.QueryParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	events, total, err := findAuthEvents(payload)
+
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching auth events", "success": false})
+	}
+
+	limit, page := pageOrDefault(PageQuery{Limit: payload.Limit, Page: payload.Page})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Auth events fetched successfully", "data": events, "count": len(events), "total": total, "page": page, "limit": limit, "success": true})
+}
+
+func findAuthEvents(payload AuthEventQuery) ([]models.AuthEvent, int64, error) {
+	limit, page := pageOrDefault(PageQuery{Limit: payload.Limit, Page: payload.Page})
+
+	db := configs.DB
+	var events []models.AuthEvent
+	var total int64
+
+	query := db.Model(&models.AuthEvent{})
+
+	if payload.AccountID != "" {
+		query = query.Where("account_id = ?", payload.AccountID)
+	}
+	if payload.Type != "" {
+		query = query.Where("type = ?", payload.Type)
+	}
+	if payload.IP != "" {
+		query = query.Where("ip = ?", payload.IP)
+	}
+	if from, err := time.Parse(time.RFC3339, payload.From); err == nil {
+		query = query.Where("created_at >= ?", from)
+	}
+	if to, err := time.Parse(time.RFC3339, payload.To); err == nil {
+		query = query.Where("created_at < ?", to)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("created_at desc, id desc").Limit(limit).Offset((page - 1) * limit).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// recordAuthEvent adds an entry to the account's security history. Without a session on the event, the
+// session of the request is used when the event is about the signed in account itself. Failures are
+// only logged, the history must never break a login.
+func recordAuthEvent(c *fiber.Ctx, event models.AuthEvent, session *models.UserLogin) {
+
+	db := configs.DB
+
+	if session == nil && event.SessionID == 0 && event.ActorID == "" {
+		if userId, _ := c.Locals("userId").(string); userId != "" && userId == event.AccountID {
+			event.SessionID, _ = c.Locals("sessionId").(int)
+		}
+	}
+
+	if session == nil && event.SessionID != 0 {
+		session = &models.UserLogin{}
+
+		if err := db.Select("id", "fcm", "platform").Limit(1).Find(session, "id = ? AND account_id = ?", event.SessionID, event.AccountID).Error; err != nil {
+			log.Printf("Error fetching session for auth event: %v", err)
+		}
+	}
+
+	if session != nil {
+		event.SessionID = session.ID
+		event.Platform = session.Platform
+		event.FCM = session.FCM
+	}
+
+	event.IP = c.IP()
+	event.UserAgent = truncate(c.Get(fiber.HeaderUserAgent), 255)
+
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Error recording %s auth event: %v", event.Type, err)
+	}
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+
+	// Cut on a rune boundary so the column never gets invalid UTF-8
+	for max > 0 && value[max]&0xC0 == 0x80 {
+		max--
+	}
+	return value[:max]
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type BlockAccountPayload struct {
+	Reason    string    `json:"reason" validate:"required,oneof=fraud abuse spam chargeback policy_violation user_request other"`
+	ExpiresAt time.Time `json:"expires_at"` // optional, the block lifts by itself afterwards
+	Notes     string    `json:"notes" validate:"omitempty,max=1000"`
+}
+type UnblockAccountPayload struct {
+	Notes string `json:"notes" validate:"omitempty,max=1000"`
+}
+type PageQuery struct {
+	Limit int `json:"limit" validate:"omitempty,number,min=1,max=100"`
+	Page  int `json:"page" validate:"omitempty,number,min=1"`
+}
+
+func BlockAccount(c *fiber.Ctx) error {
+	return restrictAccount(c, models.BlockActionBlock)
+}
+
+func BlacklistAccount(c *fiber.Ctx) error {
+	return restrictAccount(c, models.BlockActionBlacklist)
+}
+
+// restrictAccount blocks or blacklists an account and signs it out everywhere.
+func restrictAccount(c *fiber.Ctx, action string) error {
+
+	var payload *BlockAccountPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	if !payload.ExpiresAt.IsZero() && !payload.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Expiry must be in the future", "success": false})
+	}
+
+	adminId := c.Locals("userId").(string)
+	accountId := c.Params("accountId")
+
+	if accountId == adminId {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "You can't block your own account!", "success": false})
+	}
+
+	db := configs.DB
+	user := models.Account{}
+	result := db.Select("id").Limit(1).Find(&user, "id = ?", accountId)
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Account does not exist!", "success": false})
+	}
+
+	updates := map[string]interface{}{"is_logged_in": false, "updated_at": time.Now()}
+
+	if action == models.BlockActionBlock {
+		updates["is_blocked"] = true
+		updates["is_blocked_reason"] = payload.Reason
+		updates["blocked_until"] = payload.ExpiresAt
+	} else {
+		updates["is_blacklisted"] = true
+		updates["is_blacklisted_reason"] = payload.Reason
+		updates["blacklisted_until"] = payload.ExpiresAt
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if err := revokeSessions(tx.Where("account_id = ?", user.ID)); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.AccountBlockEvent{
+			AccountID:   user.ID,
+			Action:      action,
+			ReasonCode:  payload.Reason,
+			Notes:       payload.Notes,
+			ExpiresAt:   payload.ExpiresAt,
+			PerformedBy: adminId,
+		}).Error
+	})
+
+	if err != nil {
+		log.Printf("Error on account %s: %v", action, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Updating account failed. Please try again!", "success": false})
+	}
+
+	helpers.InvalidateAccount(user.ID)
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventBlock, Detail: action + ":" + payload.Reason, ActorID: adminId}, nil)
+
+	if action == models.BlockActionBlock {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Account blocked successfully", "success": true})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Account blacklisted successfully", "success": true})
+}
+
+// UnblockAccount lifts both the block and the blacklisting of an account.
+func UnblockAccount(c *fiber.Ctx) error {
+
+	var payload *UnblockAccountPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	adminId := c.Locals("userId").(string)
+	accountId := c.Params("accountId")
+
+	db := configs.DB
+	user := models.Account{}
+	result := db.Select("id", "is_blocked", "is_blacklisted").Limit(1).Find(&user, "id = ?", accountId)
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Account does not exist!", "success": false})
+	}
+
+	if !user.IsBlocked && !user.IsBlacklisted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Account is not blocked!", "success": false})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"is_blocked":            false,
+			"is_blocked_reason":     "",
+			"blocked_until":         time.Time{},
+			"is_blacklisted":        false,
+			"is_blacklisted_reason": "",
+			"blacklisted_until":     time.Time{},
+			"updated_at":            time.Now(),
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.AccountBlockEvent{
+			AccountID:   user.ID,
+			Action:      models.BlockActionUnblock,
+			Notes:       payload.Notes,
+			PerformedBy: adminId,
+		}).Error
+	})
+
+	if err != nil {
+		log.Printf("Error unblocking account: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Updating account failed. Please try again!", "success": false})
+	}
+
+	helpers.InvalidateAccount(user.ID)
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventBlock, Detail: models.BlockActionUnblock, ActorID: adminId}, nil)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Account unblocked successfully", "success": true})
+}
+
+func GetBlockHistory(c *fiber.Ctx) error {
+
+	var payload PageQuery
+
+	if err := c.QueryParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	limit, page := pageOrDefault(payload)
+	accountId := c.Params("accountId")
+
+	db := configs.DB
+	var events []models.AccountBlockEvent
+	var total int64
+
+	query := db.Model(&models.AccountBlockEvent{}).Where("account_id = ?", accountId)
+
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Account does not exist!", "success": false})
+	}
+
+	if err := query.Order("created_at desc, id desc").Limit(limit).Offset((page - 1) * limit).Find(&events).Error; err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching history", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Block history fetched successfully", "data": events, "count": len(events), "total": total, "page": page, "limit": limit, "success": true})
+}
+
+func pageOrDefault(query PageQuery) (int, int) {
+	limit, page := query.Limit, query.Page
+
+	if limit == 0 {
+		limit = 10
+	}
+	if page == 0 {
+		page = 1
+	}
+
+	return limit, page
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type ConfirmDeletionPayload struct {
+	Otp string `json:"otp" validate:"required"`
+}
+
+// RequestAccountDeletion sends the code that confirms a deletion. It goes by SMS, accounts without a
+// verified number get it by email.
+func RequestAccountDeletion(c *fiber.Ctx) error {
+
+	user := currentAccount(c)
+
+	if user.DeletionPending() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Your account is already scheduled for deletion!", "data": fiber.Map{"scheduled_at": user.DeletionScheduledAt}, "success": false})
+	}
+
+	channel, err := sendReauthOtp(c, user, helpers.EmailTemplateDeletionCode)
+
+	if err != nil {
+		return reauthErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "OTP successfully sent", "data": fiber.Map{"channel": channel}, "success": true})
+}
+
+// ConfirmAccountDeletion checks the code and schedules the deletion after the grace period. Every other
+// session is signed out, the current one stays so the user can still cancel.
+func ConfirmAccountDeletion(c *fiber.Ctx) error {
+
+	var payload *ConfirmDeletionPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	sessionId := c.Locals("sessionId")
+	user := currentAccount(c)
+
+	if user.DeletionPending() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Your account is already scheduled for deletion!", "data": fiber.Map{"scheduled_at": user.DeletionScheduledAt}, "success": false})
+	}
+
+	if err := verifyReauthOtp(c, user, payload.Otp); err != nil {
+		return reauthErrorResponse(c, err)
+	}
+
+	db := configs.DB
+	now := time.Now()
+	scheduledAt := now.Add(helpers.GetAccountDeletion().GracePeriod)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Account{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"deletion_requested_at": now,
+			"deletion_scheduled_at": scheduledAt,
+			"updated_at":            now,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return revokeSessions(tx.Where("account_id = ? AND id != ?", user.ID, sessionId))
+	})
+
+	if err != nil {
+		log.Printf("Error scheduling account deletion: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't schedule account deletion", "success": false})
+	}
+
+	helpers.InvalidateAccount(user.ID)
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventDeletion, Detail: "scheduled"}, nil)
+
+	preferences := helpers.NotificationPreferences(user.ID)
+
+	// The confirmation of the user's own request is sent whatever the preferences say
+	if user.Email != "" && user.IsEmailVerified {
+		data := helpers.EmailData{"ScheduledAt": helpers.FormatLocalTime(scheduledAt, preferences.Timezone)}
+
+		if err := helpers.SendEmail(user.Email, user.Lang, helpers.EmailTemplateDeletionDue, data); err != nil {
+			log.Printf("Error sending deletion email: %v", err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Account scheduled for deletion", "data": fiber.Map{"scheduled_at": scheduledAt}, "success": true})
+}
+
+// CancelAccountDeletion keeps the account. It works until the deletion job picked the account up.
+func CancelAccountDeletion(c *fiber.Ctx) error {
+
+	db := configs.DB
+	user := currentAccount(c)
+
+	result := db.Model(&models.Account{}).Where("id = ? AND is_deleted = ? AND deletion_scheduled_at > ?", user.ID, false, time.Now()).Updates(map[string]interface{}{
+		"deletion_requested_at": time.Time{},
+		"deletion_scheduled_at": time.Time{},
+		"updated_at":            time.Now(),
+	})
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't cancel account deletion", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Your account is not scheduled for deletion!", "success": false})
+	}
+
+	helpers.InvalidateAccount(user.ID)
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventDeletion, Detail: "cancelled"}, nil)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Account deletion cancelled", "success": true})
+}
@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// The revoke link stays valid as long as the refresh token of the new session.
+const sessionRevokeTTL = refreshTokenTTL
+
+type RevokeSessionQuery struct {
+	Token string `query:"token" form:"token" validate:"required"`
+}
+
+// Reasons a revoke link is refused.
+const (
+	sessionRevokeInvalid  = "invalid"
+	sessionRevokeExpired  = "expired"
+	sessionRevokeInactive = "inactive"
+)
+
+var errSessionInactive = errors.New("session is not active")
+
+// notifyNewDevice tells the user about a login from a device the account never used, by email and by
+// push to the account's other active devices, as far as the user's preferences allow security alerts
+// on the channel. The very first device of an account is not alerted. Delivery happens in the
+// background so a slow mail server doesn't hold up the login.
+func notifyNewDevice(c *fiber.Ctx, user *models.Account, session *models.UserLogin) {
+
+	db := configs.DB
+
+	var otherSessions []models.UserLogin
+
+	if err := db.Select("id", "fcm", "is_active").Where("account_id = ? AND id != ?", user.ID, session.ID).Find(&otherSessions).Error; err != nil {
+		log.Printf("Error fetching sessions for new device alert: %v", err)
+		return
+	}
+
+	if len(otherSessions) == 0 {
+		return
+	}
+
+	preferences := helpers.NotificationPreferences(user.ID)
+
+	var tokens []string
+
+	if preferences.Allows(models.NotificationChannelPush, models.NotificationCategorySecurity) {
+		for _, other := range otherSessions {
+			if other.IsActive && other.FCM != "" && other.FCM != session.FCM {
+				tokens = append(tokens, other.FCM)
+			}
+		}
+	}
+
+	revokeToken, err := helpers.GenerateToken(helpers.TokenTypeSessionRevoke, helpers.TokenClaims{
+		UserId:    user.ID,
+		SessionId: session.ID,
+	}, sessionRevokeTTL)
+
+	if err != nil {
+		log.Printf("Error generating session revoke token: %v", err)
+		return
+	}
+
+	// Fiber reuses the request buffers, the values must be copied before the request ends
+	data := map[string]string{
+		"Platform":   strings.Clone(session.Platform),
+		"IP":         strings.Clone(c.IP()),
+		"UserAgent":  truncate(strings.Clone(c.Get(fiber.HeaderUserAgent)), 255),
+		"Time":       helpers.FormatLocalTime(time.Now(), preferences.Timezone),
+		"RevokeLink": helpers.TokenLink(helpers.GetAppLinks().SessionRevoke, revokeToken),
+		"SessionId":  strconv.Itoa(session.ID),
+	}
+
+	email := ""
+	if user.IsEmailVerified && preferences.Allows(models.NotificationChannelEmail, models.NotificationCategorySecurity) {
+		email = user.Email
+	}
+	lang := user.Lang
+
+	go func() {
+		if email != "" {
+			emailData := helpers.EmailData{}
+			for key, value := range data {
+				emailData[key] = value
+			}
+
+			if err := helpers.SendEmail(email, lang, helpers.EmailTemplateNewDeviceLogin, emailData); err != nil {
+				log.Printf("Error sending new device email: %v", err)
+			}
+		}
+
+		if len(tokens) > 0 {
+			// The devices get the session id to open the sessions screen, the link itself stays in the email
+			pushData := map[string]string{"Platform": data["Platform"], "SessionId": data["SessionId"]}
+
+			if err := helpers.SendPush(tokens, lang, helpers.PushTemplateNewDeviceLogin, pushData); err != nil {
+				log.Printf("Error sending new device push: %v", err)
+			}
+		}
+	}()
+}
+
+// RevokeSessionFromAlert opens the link in a new device alert. Mail scanners follow links on their own,
+// so it only shows a page asking to confirm, the form posts to ConfirmSessionRevokeFromAlert.
+func RevokeSessionFromAlert(c *fiber.Ctx) error {
+
+	var query RevokeSessionQuery
+
+	lang := c.AcceptsLanguages(helpers.PageLanguages()...)
+
+	if err := c.QueryParser(&query); err != nil || query.Token == "" {
+		return sessionRevokeResponse(c, lang, sessionRevokeInvalid)
+	}
+
+	claims, reason := parseSessionRevokeToken(query.Token)
+
+	if reason != "" {
+		return sessionRevokeResponse(c, lang, reason)
+	}
+
+	lang = accountPageLang(claims.UserId, lang)
+
+	session := models.UserLogin{}
+	result := configs.DB.Select("id", "platform").Limit(1).Find(&session, "id = ? AND account_id = ? AND is_active = ?", claims.SessionId, claims.UserId, true)
+
+	if result.Error != nil {
+		log.Printf("Error fetching session for revoke link: %v", result.Error)
+		return c.Status(fiber.StatusBadGateway).SendString("Something bad happened. Please try again!")
+	}
+
+	if result.RowsAffected == 0 {
+		return sessionRevokeResponse(c, lang, sessionRevokeInactive)
+	}
+
+	return sessionRevokePage(c, lang, fiber.StatusOK, helpers.PageData{
+		"Confirm":  true,
+		"Token":    query.Token,
+		"Platform": session.Platform,
+	})
+}
+
+// ConfirmSessionRevokeFromAlert signs out the session once the user confirmed on the page. The link
+// works once, and only for the session it was sent for, every login starts a new one.
+func ConfirmSessionRevokeFromAlert(c *fiber.Ctx) error {
+
+	var payload RevokeSessionQuery
+
+	lang := c.AcceptsLanguages(helpers.PageLanguages()...)
+
+	if err := c.BodyParser(&payload); err != nil || payload.Token == "" {
+		return sessionRevokeResponse(c, lang, sessionRevokeInvalid)
+	}
+
+	claims, reason := parseSessionRevokeToken(payload.Token)
+
+	if reason != "" {
+		return sessionRevokeResponse(c, lang, reason)
+	}
+
+	lang = accountPageLang(claims.UserId, lang)
+
+	err := configs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := helpers.ConsumeToken(tx, claims); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.UserLogin{}).Where("id = ? AND account_id = ? AND is_active = ?", claims.SessionId, claims.UserId, true).Updates(map[string]interface{}{
+			"is_active":  false,
+			"updated_at": time.Now(),
+		})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errSessionInactive
+		}
+
+		return nil
+	})
+
+	switch err {
+	case nil:
+	case helpers.ErrTokenUsed:
+		return sessionRevokeResponse(c, lang, sessionRevokeInvalid)
+	case errSessionInactive:
+		return sessionRevokeResponse(c, lang, sessionRevokeInactive)
+	default:
+		log.Printf("Error revoking session from alert: %v", err)
+		return c.Status(fiber.StatusBadGateway).SendString("Something bad happened. Please try again!")
+	}
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: claims.UserId, Type: models.AuthEventLogout, Detail: "new_device_alert", SessionID: claims.SessionId}, nil)
+
+	return sessionRevokeResponse(c, lang, "")
+}
+
+// parseSessionRevokeToken returns the claims of a revoke link, or the reason it is refused.
+func parseSessionRevokeToken(token string) (*helpers.TokenClaims, string) {
+	claims, err := helpers.ParseToken(token, helpers.TokenTypeSessionRevoke)
+
+	if err != nil {
+		if helpers.IsTokenExpired(err) {
+			return nil, sessionRevokeExpired
+		}
+		return nil, sessionRevokeInvalid
+	}
+
+	if claims.SessionId == 0 {
+		return nil, sessionRevokeInvalid
+	}
+
+	return claims, ""
+}
+
+// accountPageLang prefers the account's language over the browser's for pages opened from a link.
+func accountPageLang(accountId string, lang string) string {
+	user := models.Account{}
+
+	if err := configs.DB.Select("id", "lang").Limit(1).Find(&user, "id = ?", accountId).Error; err == nil && user.Lang != "" {
+		return user.Lang
+	}
+
+	return lang
+}
+
+// sessionRevokeResponse answers a revoke link, an empty reason means the session was signed out.
+func sessionRevokeResponse(c *fiber.Ctx, lang string, reason string) error {
+
+	status := fiber.StatusOK
+	if reason != "" {
+		status = fiber.StatusBadRequest
+	}
+
+	return sessionRevokePage(c, lang, status, helpers.PageData{
+		"Success": reason == "",
+		"Reason":  reason,
+	})
+}
+
+func sessionRevokePage(c *fiber.Ctx, lang string, status int, data helpers.PageData) error {
+
+	page, err := helpers.RenderPage(helpers.PageTemplateSessionRevoke, lang, data)
+
+	if err != nil {
+		log.Printf("Error rendering session revoke page: %v", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Something bad happened. Please try again!")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(status).SendString(page)
+}
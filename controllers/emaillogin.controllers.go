@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const emailLoginTTL = 10 * time.Minute
+
+type EmailLoginPayload struct {
+	Email  string `json:"email" validate:"required,email"`
+	Method string `json:"method" validate:"required,oneof=link code"`
+}
+type EmailLoginVerifyPayload struct {
+	Token    string `json:"token" validate:"required_without=Otp"` // from the link
+	Email    string `json:"email" validate:"required_with=Otp,omitempty,email"`
+	Otp      string `json:"otp" validate:"required_without=Token"`
+	FCM      string `json:"fcm" validate:"required"`
+	Platform string `json:"platform" validate:"required"`
+}
+
+// EmailLogin sends a login link or code to a verified email address. The link and the code are stored
+// like SMS codes, so a new one replaces the previous one and each can only be used once.
+func EmailLogin(c *fiber.Ctx) error {
+
+	var payload *EmailLoginPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	// The response is the same whether or not the address belongs to an account, so failures after the
+	// lookup are only logged
+	response := fiber.Map{"message": "If the email belongs to an account, a login email has been sent", "success": true}
+
+	db := configs.DB
+	userExist := models.Account{}
+	result := db.Limit(1).Find(&userExist, "email = ? AND is_email_verified = ?", strings.ToLower(payload.Email), true)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 || userExist.BlockActive() || userExist.BlacklistActive() {
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+
+	var secret, template string
+	var data helpers.EmailData
+
+	if payload.Method == "link" {
+		token, err := helpers.GenerateToken(helpers.TokenTypeEmailLogin, helpers.TokenClaims{
+			UserId: userExist.ID,
+			Email:  userExist.Email,
+		}, emailLoginTTL)
+
+		if err != nil {
+			log.Printf("Error generating email login token: %v", err)
+			return c.Status(fiber.StatusOK).JSON(response)
+		}
+
+		secret = token
+		template = helpers.EmailTemplateEmailLoginLink
+		data = helpers.EmailData{"Link": helpers.TokenLink(helpers.GetAppLinks().EmailLogin, token)}
+	} else {
+		otp, err := helpers.GenerateOtp()
+
+		if err != nil {
+			log.Printf("Error generating email login code: %v", err)
+			return c.Status(fiber.StatusOK).JSON(response)
+		}
+
+		secret = otp
+		template = helpers.EmailTemplateEmailLoginCode
+		data = helpers.EmailData{"Code": otp}
+	}
+
+	if err := storeAccountOtp(c, &userExist, models.OtpChannelEmailLogin, secret, emailLoginTTL); err != nil {
+		log.Printf("Error storing email login code for account %s: %v", userExist.ID, err)
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+
+	if err := helpers.SendEmail(userExist.Email, userExist.Lang, template, data); err != nil {
+		log.Printf("Error sending login email: %v", err)
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// EmailLoginVerify exchanges a login link token or an email code for a session, like LoginVerifyOTP.
+func EmailLoginVerify(c *fiber.Ctx) error {
+
+	var payload *EmailLoginVerifyPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	db := configs.DB
+	userExist := models.Account{}
+	secret := payload.Otp
+
+	if payload.Token != "" {
+		claims, err := helpers.ParseToken(payload.Token, helpers.TokenTypeEmailLogin)
+
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid or expired login link. Please try again!", "success": false})
+		}
+
+		result := db.Limit(1).Find(&userExist, "id = ? AND email = ? AND is_email_verified = ?", claims.UserId, claims.Email, true)
+
+		if result.Error != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+		}
+
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid or expired login link. Please try again!", "success": false})
+		}
+
+		secret = payload.Token
+	} else {
+		result := db.Limit(1).Find(&userExist, "email = ? AND is_email_verified = ?", strings.ToLower(payload.Email), true)
+
+		if result.Error != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+		}
+
+		if result.RowsAffected == 0 {
+			return otpErrorResponse(c, errOtpInvalid)
+		}
+	}
+
+	if userExist.BlockActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
+	}
+	if userExist.BlacklistActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
+	}
+
+	// Matching the link or code also spends it
+	if err := verifyChannelOtp(c, &userExist, models.OtpChannelEmailLogin, secret); err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	return loginUser(c, &userExist, payload.FCM, payload.Platform)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/jobs"
+	"ecommerce/models"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Building an archive reads every table of the account, so users can't ask for one more often.
+const dataExportCooldown = time.Hour
+
+type DownloadExportQuery struct {
+	Expires   string `query:"expires" validate:"required"`
+	Signature string `query:"signature" validate:"required"`
+}
+
+// RequestDataExport queues a copy of everything stored about the account. The archive is built in the
+// background and the download link is emailed once it is ready.
+func RequestDataExport(c *fiber.Ctx) error {
+
+	db := configs.DB
+	user := currentAccount(c)
+
+	last := models.DataExport{}
+	result := db.Limit(1).Order("created_at desc").Find(&last, "account_id = ?", user.ID)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected > 0 {
+		if last.Status == models.DataExportPending || last.Status == models.DataExportBuilding {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Your data export is being prepared!", "data": fiber.Map{"id": last.ID}, "success": false})
+		}
+
+		if time.Since(last.CreatedAt) < dataExportCooldown {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"message": "You have asked for a data export recently. Please try again later!", "success": false})
+		}
+	}
+
+	export := models.DataExport{AccountID: user.ID, Status: models.DataExportPending}
+
+	if err := db.Create(&export).Error; err != nil {
+		log.Printf("Error creating data export: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't start data export", "success": false})
+	}
+
+	jobs.WakeDataExports()
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Data export requested. We will email you when it is ready", "data": fiber.Map{"id": export.ID, "status": export.Status}, "success": true})
+}
+
+// GetDataExports lists the account's recent exports with the download link of the ready ones.
+func GetDataExports(c *fiber.Ctx) error {
+
+	db := configs.DB
+	user := currentAccount(c)
+
+	var exports []models.DataExport
+
+	if err := db.Where("account_id = ?", user.ID).Order("created_at desc").Limit(10).Find(&exports).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching data exports", "success": false})
+	}
+
+	data := make([]fiber.Map, 0, len(exports))
+
+	for _, export := range exports {
+		item := fiber.Map{
+			"id":         export.ID,
+			"status":     export.Status,
+			"size":       export.Size,
+			"created_at": export.CreatedAt,
+		}
+
+		if export.Status == models.DataExportReady && time.Now().Before(export.ExpiresAt) {
+			item["expires_at"] = export.ExpiresAt
+			item["download_url"] = jobs.DataExportLink(&export)
+		}
+
+		data = append(data, item)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Data exports fetched successfully", "data": data, "count": len(data), "success": true})
+}
+
+// DownloadDataExport serves the archive. It is opened from the emailed link, the signature takes the
+// place of authentication.
+func DownloadDataExport(c *fiber.Ctx) error {
+
+	var query DownloadExportQuery
+
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(query); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	exportId := c.Params("exportId")
+
+	if err := helpers.VerifySignedURL(jobs.DataExportResource(exportId), query.Expires, query.Signature); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	db := configs.DB
+	export := models.DataExport{}
+	result := db.Limit(1).Find(&export, "id = ?", exportId)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 || export.Status != models.DataExportReady || !time.Now().Before(export.ExpiresAt) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Data export does not exist or has expired!", "success": false})
+	}
+
+	return c.Download(export.FilePath, "data-export-"+export.CompletedAt.Format("2006-01-02")+".zip")
+}
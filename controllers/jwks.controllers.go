@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"ecommerce/helpers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetJWKS(c *fiber.Ctx) error {
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+	return c.Status(fiber.StatusOK).JSON(helpers.JWKS())
+}
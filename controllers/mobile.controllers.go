@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	mobileChangeTTL = 10 * time.Minute
+
+	// How old a Google or Apple ID token may be to re-authenticate a change
+	idTokenReauthMaxAge = 5 * time.Minute
+)
+
+var (
+	errMobileTaken          = errors.New("This mobile number is already registered!")
+	errTwoFactorRequired    = errors.New("Please enter the code from your authenticator app!")
+	errInvalidReauthIdToken = errors.New("Please sign in with Google or Apple again!")
+	errNoMobileReauth       = errors.New("Please verify your email or sign in with Google or Apple again!")
+)
+
+type ChangeMobilePayload struct {
+	Mobile        string `json:"mobile" validate:"required,max=20"`
+	CountryCode   string `json:"country_code" validate:"omitempty,max=4"`
+	Password      string `json:"password"`        // re-authenticates instead of confirming from the old number
+	TwoFactorCode string `json:"two_factor_code"` // re-authenticates accounts with 2FA that have no old number
+	RecoveryCode  string `json:"recovery_code"`
+	IdToken       string `json:"id_token"` // fresh Google or Apple ID token, for accounts without a verified email
+}
+type ConfirmMobileChangePayload struct {
+	NewOtp string `json:"new_otp" validate:"required"`
+	OldOtp string `json:"old_otp"`
+}
+
+// ChangeMobile starts a change of the mobile number. A code goes to the new number and, unless the user
+// re-authenticated with their password, another one goes to the old number. Accounts without an old
+// number re-authenticate with their 2FA code, a code sent to their verified email or a fresh ID token.
+func ChangeMobile(c *fiber.Ctx) error {
+
+	var payload *ChangeMobilePayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	phone, err := helpers.ParsePhone(payload.Mobile, payload.CountryCode)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	payload.Mobile = phone.E164()
+
+	db := configs.DB
+	user := currentAccount(c)
+
+	if !user.IsVerified() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You are not verified! Please verify your account!", "success": false})
+	}
+
+	if payload.Mobile == user.Mobile {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "This is already your mobile number!", "success": false})
+	}
+
+	if taken, err := isMobileTaken(db, payload.Mobile, user.ID); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	} else if taken {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": errMobileTaken.Error(), "success": false})
+	}
+
+	// The channel the second code goes to, empty once the user re-authenticated another way
+	confirmChannel := models.OtpChannelSms
+
+	if user.Mobile == "" {
+		// Accounts from Google or Apple sign in have no old number to confirm from
+		channel, err := reauthenticateWithoutMobile(user, payload)
+
+		if err != nil {
+			return mobileReauthErrorResponse(c, err)
+		}
+
+		confirmChannel = channel
+	} else if payload.Password != "" {
+		account := models.Account{}
+
+		if err := db.Select("id", "password").First(&account, "id = ?", user.ID).Error; err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+		}
+
+		if account.Password == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "No password is set. Please confirm from your old number!", "success": false})
+		}
+
+		if err := checkPassword(&account, payload.Password); err != nil {
+			return passwordErrorResponse(c, err)
+		}
+
+		confirmChannel = ""
+	}
+
+	if err := helpers.CheckMobileOTPSend(payload.Mobile); err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	switch confirmChannel {
+	case models.OtpChannelSms:
+		if err := helpers.CheckMobileOTPSend(user.Mobile); err != nil {
+			return otpErrorResponse(c, err)
+		}
+	case models.OtpChannelEmail:
+		if err := helpers.CheckEmailOTPSend(user.Email); err != nil {
+			return otpErrorResponse(c, err)
+		}
+	}
+
+	changeRequest := models.MobileChangeRequest{}
+
+	if err := db.Where(models.MobileChangeRequest{AccountID: user.ID}).FirstOrInit(&changeRequest).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	// The request row keeps its own cooldown, send window and lock, they hold without memcache too
+	now := time.Now()
+
+	if err := helpers.CheckOTPSend(&changeRequest.OtpThrottle, now); err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	newOtp, newOtpHash, err := newOtpCode()
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something bad happened on server", "success": false})
+	}
+
+	var oldOtp, oldOtpHash string
+
+	if confirmChannel != "" {
+		if oldOtp, oldOtpHash, err = newOtpCode(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something bad happened on server", "success": false})
+		}
+	}
+
+	changeRequest.NewMobile = payload.Mobile
+	changeRequest.NewCountryCode = phone.CountryCode
+	changeRequest.NewOtp = newOtpHash
+	changeRequest.OldOtp = oldOtpHash
+	changeRequest.ExpiredAt = now.Add(mobileChangeTTL)
+	helpers.RecordOTPSend(&changeRequest.OtpThrottle, now)
+
+	if err := db.Save(&changeRequest).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't start mobile number change", "success": false})
+	}
+
+	helpers.RecordMobileOTPSend(payload.Mobile)
+
+	switch confirmChannel {
+	case models.OtpChannelSms:
+		helpers.RecordMobileOTPSend(user.Mobile)
+	case models.OtpChannelEmail:
+		helpers.RecordEmailOTPSend(user.Email)
+	}
+
+	if err := helpers.SendOTP(newOtp, payload.Mobile); err != nil {
+		log.Printf("Error sending OTP: %v", err)
+		return otpErrorResponse(c, errOtpDelivery)
+	}
+
+	switch confirmChannel {
+	case models.OtpChannelSms:
+		if err := helpers.SendOTP(oldOtp, user.Mobile); err != nil {
+			log.Printf("Error sending OTP: %v", err)
+			return otpErrorResponse(c, errOtpDelivery)
+		}
+	case models.OtpChannelEmail:
+		if err := helpers.SendEmail(user.Email, user.Lang, helpers.EmailTemplateSecurityCode, helpers.EmailData{"Code": oldOtp}); err != nil {
+			log.Printf("Error sending %s email: %v", helpers.EmailTemplateSecurityCode, err)
+			return otpErrorResponse(c, errOtpDelivery)
+		}
+	}
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventOtpSent, Detail: "mobile_change"}, nil)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "OTP successfully sent", "data": fiber.Map{
+		"oldMobileConfirmationRequired": confirmChannel == models.OtpChannelSms,
+		"emailConfirmationRequired":     confirmChannel == models.OtpChannelEmail,
+	}, "success": true})
+}
+
+// ConfirmMobileChange checks the codes and switches the account to the new number. Every other session
+// is signed out.
+func ConfirmMobileChange(c *fiber.Ctx) error {
+
+	var payload *ConfirmMobileChangePayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	sessionId := c.Locals("sessionId")
+
+	db := configs.DB
+	user := currentAccount(c)
+
+	changeRequest := models.MobileChangeRequest{}
+	result := db.Limit(1).Find(&changeRequest, "account_id = ?", user.ID)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return otpErrorResponse(c, errOtpNotFound)
+	}
+
+	now := time.Now()
+
+	if err := helpers.CheckOTPVerify(&changeRequest.OtpThrottle, now); err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	// The row stays after the codes expire, its send counters still apply to the next request
+	if now.After(changeRequest.ExpiredAt) {
+		return otpErrorResponse(c, errOtpExpired)
+	}
+
+	if changeRequest.OldOtp != "" && payload.OldOtp == "" {
+		if user.Mobile == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Please enter the code sent to your email!", "success": false})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Please enter the OTP sent to your old number!", "success": false})
+	}
+
+	err := verifyMobileChangeOtp(changeRequest.NewMobile, changeRequest.NewOtp, payload.NewOtp)
+
+	if err == nil && changeRequest.OldOtp != "" {
+		// Without an old number the second code went to the verified email
+		if user.Mobile == "" {
+			err = verifyEmailChangeOtp(user.Email, changeRequest.OldOtp, payload.OldOtp)
+		} else {
+			err = verifyMobileChangeOtp(user.Mobile, changeRequest.OldOtp, payload.OldOtp)
+		}
+	}
+
+	if err != nil {
+		// The memcache counters fail open, the request itself also locks after too many wrong codes
+		limitErr := helpers.RecordOTPFailure(&changeRequest.OtpThrottle, now)
+
+		// The lock burns the codes
+		if limitErr != nil {
+			changeRequest.ExpiredAt = now
+		}
+
+		if err := db.Save(&changeRequest).Error; err != nil {
+			log.Printf("Error saving mobile change attempts: %v", err)
+		}
+
+		recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventOtpFailed, Detail: "mobile_change"}, nil)
+
+		if limitErr != nil {
+			return otpErrorResponse(c, limitErr)
+		}
+
+		return otpErrorResponse(c, err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if taken, err := isMobileTaken(tx, changeRequest.NewMobile, user.ID); err != nil {
+			return err
+		} else if taken {
+			return errMobileTaken
+		}
+
+		err := tx.Model(&models.Account{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"mobile":             changeRequest.NewMobile,
+			"country_code":       changeRequest.NewCountryCode,
+			"is_mobile_verified": true,
+			"updated_at":         time.Now(),
+		}).Error
+
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errMobileTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&changeRequest).Error; err != nil {
+			return err
+		}
+
+		return revokeSessions(tx.Where("account_id = ? AND id != ?", user.ID, sessionId))
+	})
+
+	if err == errMobileTaken {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if err != nil {
+		log.Printf("Error changing mobile number: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't change mobile number", "success": false})
+	}
+
+	helpers.InvalidateAccount(user.ID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Mobile number changed successfully", "success": true})
+}
+
+func isMobileTaken(db *gorm.DB, mobile string, accountId string) (bool, error) {
+	var count int64
+	err := db.Model(&models.Account{}).Where("mobile = ? AND id != ?", mobile, accountId).Count(&count).Error
+	return count > 0, err
+}
+
+// newOtpCode returns a fresh code together with its hash.
+func newOtpCode() (string, string, error) {
+	otp, err := helpers.GenerateOtp()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	otpHash, err := helpers.HashOtp(otp)
+
+	return otp, otpHash, err
+}
+
+// verifyMobileChangeOtp compares a code sent to mobile, counting wrong ones against the number.
+func verifyMobileChangeOtp(mobile string, otpHash string, otp string) error {
+	if err := helpers.CheckMobileOTPVerify(mobile); err != nil {
+		return err
+	}
+
+	if helpers.CompareOtp(otpHash, otp) {
+		helpers.ResetMobileOTPFailures(mobile)
+		return nil
+	}
+
+	if err := helpers.RecordMobileOTPFailure(mobile); err != nil {
+		return err
+	}
+
+	return errOtpInvalid
+}
+
+// verifyEmailChangeOtp compares a code sent to the email, counting wrong ones against the address.
+func verifyEmailChangeOtp(email string, otpHash string, otp string) error {
+	if err := helpers.CheckEmailOTPVerify(email); err != nil {
+		return err
+	}
+
+	if helpers.CompareOtp(otpHash, otp) {
+		helpers.ResetEmailOTPFailures(email)
+		return nil
+	}
+
+	if err := helpers.RecordEmailOTPFailure(email); err != nil {
+		return err
+	}
+
+	return errOtpInvalid
+}
+
+// reauthenticateWithoutMobile checks that the user of an account without a mobile number is really
+// present. With 2FA on the authenticator code is required, otherwise a fresh ID token from the linked
+// provider counts. Failing both, it returns the email channel for a confirmation code.
+func reauthenticateWithoutMobile(user *models.Account, payload *ChangeMobilePayload) (string, error) {
+	twoFactor := models.AccountTwoFactor{}
+	result := configs.DB.Limit(1).Find(&twoFactor, "account_id = ? AND is_enabled = ?", user.ID, true)
+
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		if payload.TwoFactorCode == "" && payload.RecoveryCode == "" {
+			return "", errTwoFactorRequired
+		}
+
+		return "", verifyTwoFactorCode(&twoFactor, payload.TwoFactorCode, payload.RecoveryCode)
+	}
+
+	if payload.IdToken != "" {
+		return "", verifyReauthIdToken(user, payload.IdToken)
+	}
+
+	if user.Email != "" && user.IsEmailVerified {
+		return models.OtpChannelEmail, nil
+	}
+
+	return "", errNoMobileReauth
+}
+
+// verifyReauthIdToken accepts an ID token for the provider identity linked to the account, issued
+// within the last few minutes.
+func verifyReauthIdToken(user *models.Account, idToken string) error {
+	for provider, subject := range map[string]string{helpers.OAuthProviderGoogle: user.GoogleID, helpers.OAuthProviderApple: user.AppleID} {
+		verifier := helpers.GetOAuthVerifier(provider)
+
+		if subject == "" || verifier == nil {
+			continue
+		}
+
+		identity, err := verifier.Verify(idToken)
+
+		if err != nil {
+			continue
+		}
+
+		if identity.Subject == subject && time.Since(identity.IssuedAt) <= idTokenReauthMaxAge {
+			return nil
+		}
+	}
+
+	return errInvalidReauthIdToken
+}
+
+func mobileReauthErrorResponse(c *fiber.Ctx, err error) error {
+	switch err {
+	case errTwoFactorRequired, errNoMobileReauth:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	case errInvalidReauthIdToken:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+	return twoFactorErrorResponse(c, err)
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OAuthLoginPayload struct {
+	IdToken  string `json:"id_token" validate:"required"`
+	Name     string `json:"name" validate:"omitempty,max=100"` // Apple only hands the name to the app on the first sign in
+	FCM      string `json:"fcm" validate:"required"`
+	Platform string `json:"platform" validate:"required"`
+	Language string `json:"language"`
+}
+
+func GoogleLogin(c *fiber.Ctx) error {
+	return oauthLogin(c, helpers.OAuthProviderGoogle, "google_id")
+}
+
+func AppleLogin(c *fiber.Ctx) error {
+	return oauthLogin(c, helpers.OAuthProviderApple, "apple_id")
+}
+
+// oauthLogin signs in with a provider ID token. The account is found by the provider id, then by a
+// verified email address, and is created when neither matches.
+func oauthLogin(c *fiber.Ctx, provider string, idColumn string) error {
+
+	var payload *OAuthLoginPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	verifier := helpers.GetOAuthVerifier(provider)
+
+	if verifier == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "This sign in method is not enabled", "success": false})
+	}
+
+	identity, err := verifier.Verify(payload.IdToken)
+
+	if err != nil {
+		log.Printf("Error verifying %s ID token: %v", provider, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid ID token. Please try again!", "success": false})
+	}
+
+	db := configs.DB
+	user := models.Account{}
+
+	result := db.Limit(1).Find(&user, idColumn+" = ?", identity.Subject)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 && identity.Email != "" && identity.EmailVerified {
+		// Only link to an address we verified ourselves, anyone can put an unverified address on their account
+		result = db.Limit(1).Find(&user, "email = ? AND is_email_verified = ?", identity.Email, true)
+
+		if result.Error != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+		}
+
+		if result.RowsAffected > 0 {
+			// Never move the account over to a different provider account, only fill an empty slot
+			linked := db.Model(&user).Where(idColumn+" IS NULL OR "+idColumn+" = ''").Update(idColumn, identity.Subject)
+
+			if linked.Error != nil {
+				return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
+			}
+
+			if linked.RowsAffected == 0 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "This email is already linked to a different " + provider + " sign in", "success": false})
+			}
+		}
+	}
+
+	if result.RowsAffected == 0 {
+		user = models.Account{
+			Name: strings.TrimSpace(identity.Name),
+			Lang: payload.Language,
+		}
+
+		if user.Name == "" {
+			user.Name = strings.TrimSpace(payload.Name)
+		}
+
+		if identity.Email != "" && identity.EmailVerified {
+			var emailTaken int64
+			db.Model(&models.Account{}).Where("email = ?", identity.Email).Count(&emailTaken)
+
+			if emailTaken == 0 {
+				user.Email = identity.Email
+				user.IsEmailVerified = true
+			}
+		}
+
+		if provider == helpers.OAuthProviderGoogle {
+			user.GoogleID = identity.Subject
+		} else {
+			user.AppleID = identity.Subject
+		}
+
+		if err := db.Create(&user).Error; err != nil {
+			log.Printf("Error creating %s account: %v", provider, err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
+		}
+	}
+
+	if user.BlockActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": user.IsBlockedReason, "success": false})
+	}
+	if user.BlacklistActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": user.IsBlacklistedReason, "success": false})
+	}
+
+	return loginUser(c, &user, payload.FCM, payload.Platform)
+}
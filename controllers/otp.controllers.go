@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errOtpNotFound = errors.New("No OTP found. Please request a new OTP!")
+	errOtpExpired  = errors.New("OTP has expired. Please try again!")
+	errOtpInvalid  = errors.New("Invalid OTP. Please try again!")
+	errOtpDelivery = errors.New("Failed to send OTP")
+)
+
+// sendAccountOtp issues a new code for the account after checking the resend limits and sends it
+// to the account's mobile number.
+func sendAccountOtp(c *fiber.Ctx, user *models.Account, validFor time.Duration) error {
+	otp, err := helpers.GenerateOtp()
+
+	if err != nil {
+		return err
+	}
+
+	if err := storeAccountOtp(c, user, models.OtpChannelSms, otp, validFor); err != nil {
+		return err
+	}
+
+	if err := helpers.SendOTP(otp, user.Mobile); err != nil {
+		log.Printf("Error sending OTP: %v", err)
+		return errOtpDelivery
+	}
+
+	return nil
+}
+
+// storeAccountOtp makes otp the account's current code for the channel after checking the resend
+// limits. The caller delivers it.
+func storeAccountOtp(c *fiber.Ctx, user *models.Account, channel string, otp string, validFor time.Duration) error {
+	db := configs.DB
+	now := time.Now()
+
+	userOtp := models.UserOtp{}
+
+	if err := db.FirstOrCreate(&userOtp, models.UserOtp{AccountID: user.ID, Channel: channel}).Error; err != nil {
+		return err
+	}
+
+	if err := helpers.CheckOTPSend(&userOtp.OtpThrottle, now); err != nil {
+		return err
+	}
+
+	if isEmailOtpChannel(channel) {
+		if err := helpers.CheckEmailOTPSend(user.Email); err != nil {
+			return err
+		}
+	} else if err := helpers.CheckMobileOTPSend(user.Mobile); err != nil {
+		return err
+	}
+
+	otpHash, err := helpers.HashOtp(otp)
+
+	if err != nil {
+		return err
+	}
+
+	userOtp.Otp = otpHash
+	userOtp.IsExpired = false
+	userOtp.ExpiredDateTime = now.Add(validFor)
+	helpers.RecordOTPSend(&userOtp.OtpThrottle, now)
+
+	if err := db.Save(&userOtp).Error; err != nil {
+		return err
+	}
+
+	// Only codes that were really issued count against the recipient
+	if isEmailOtpChannel(channel) {
+		helpers.RecordEmailOTPSend(user.Email)
+	} else {
+		helpers.RecordMobileOTPSend(user.Mobile)
+	}
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventOtpSent, Detail: channel}, nil)
+
+	return nil
+}
+
+// isEmailOtpChannel reports whether codes of the channel go to the account's email address.
+func isEmailOtpChannel(channel string) bool {
+	return channel == models.OtpChannelEmailLogin || channel == models.OtpChannelEmailReauth
+}
+
+// verifyAccountOtp checks the code against the account's current SMS code.
+func verifyAccountOtp(c *fiber.Ctx, user *models.Account, otp string) error {
+	return verifyChannelOtp(c, user, models.OtpChannelSms, otp)
+}
+
+// verifyChannelOtp checks the code against the account's current code for the channel, counting
+// wrong guesses towards the lockout. A matched code is spent so it cannot be used twice.
+func verifyChannelOtp(c *fiber.Ctx, user *models.Account, channel string, otp string) error {
+	db := configs.DB
+	now := time.Now()
+
+	checkRecipient, recordRecipientFailure, resetRecipient := helpers.CheckMobileOTPVerify, helpers.RecordMobileOTPFailure, helpers.ResetMobileOTPFailures
+	recipient := user.Mobile
+
+	if isEmailOtpChannel(channel) {
+		checkRecipient, recordRecipientFailure, resetRecipient = helpers.CheckEmailOTPVerify, helpers.RecordEmailOTPFailure, helpers.ResetEmailOTPFailures
+		recipient = user.Email
+	}
+
+	if err := checkRecipient(recipient); err != nil {
+		return err
+	}
+
+	userOtp := models.UserOtp{}
+
+	result := db.Limit(1).Find(&userOtp, "account_id = ? AND channel = ?", user.ID, channel)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errOtpNotFound
+	}
+
+	if err := helpers.CheckOTPVerify(&userOtp.OtpThrottle, now); err != nil {
+		return err
+	}
+
+	if userOtp.IsExpired || now.After(userOtp.ExpiredDateTime) {
+		return errOtpExpired
+	}
+
+	if !helpers.CompareOtp(userOtp.Otp, otp) {
+		limitErr := helpers.RecordOTPFailure(&userOtp.OtpThrottle, now)
+
+		// The lock burns the code
+		if limitErr != nil {
+			userOtp.IsExpired = true
+		}
+
+		recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventOtpFailed, Detail: channel}, nil)
+
+		if err := db.Save(&userOtp).Error; err != nil {
+			return err
+		}
+
+		if recipientErr := recordRecipientFailure(recipient); limitErr == nil {
+			limitErr = recipientErr
+		}
+
+		if limitErr != nil {
+			return limitErr
+		}
+
+		return errOtpInvalid
+	}
+
+	// Only one request can spend the code, a concurrent one finds it expired
+	spend := db.Model(&models.UserOtp{}).Where("id = ? AND is_expired = ?", userOtp.ID, false).Updates(map[string]interface{}{"is_expired": true, "attempts": 0})
+
+	if spend.Error != nil {
+		return spend.Error
+	}
+
+	if spend.RowsAffected == 0 {
+		return errOtpExpired
+	}
+
+	resetRecipient(recipient)
+
+	return nil
+}
+
+// otpErrorResponse maps the errors of sendAccountOtp and verifyAccountOtp to a response.
+func otpErrorResponse(c *fiber.Ctx, err error) error {
+	var limitErr *helpers.OTPLimitError
+
+	if errors.As(err, &limitErr) {
+		retryAfter := int(math.Ceil(limitErr.RetryAfter.Seconds()))
+
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"message": limitErr.Message, "data": fiber.Map{"reason": limitErr.Reason, "retry_after": retryAfter}, "success": false})
+	}
+
+	switch err {
+	case errOtpNotFound, errOtpInvalid:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	case errOtpExpired:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error(), "success": false})
+	case errOtpDelivery:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	log.Printf("Error handling OTP: %v", err)
+	return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+}
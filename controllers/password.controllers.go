@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+var errInvalidPassword = errors.New("Invalid credentials. Please try again!")
+
+type SetPasswordPayload struct {
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	Otp      string `json:"otp" validate:"required"` // from RequestSetPasswordOtp
+}
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+}
+type PasswordLoginPayload struct {
+	Mobile      string `json:"mobile" validate:"required_without=Email,omitempty,max=20"`
+	CountryCode string `json:"country_code" validate:"omitempty,max=4"`
+	Email       string `json:"email" validate:"required_without=Mobile,omitempty,email"`
+	Password    string `json:"password" validate:"required"`
+	FCM         string `json:"fcm" validate:"required"`
+	Platform    string `json:"platform" validate:"required"`
+}
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// RequestSetPasswordOtp sends the code SetPassword asks for. A password is a lasting credential, an
+// access token alone must not be enough to add one.
+func RequestSetPasswordOtp(c *fiber.Ctx) error {
+
+	user := currentAccount(c)
+
+	db := configs.DB
+	account := models.Account{}
+
+	if err := db.Select("id", "password").First(&account, "id = ?", user.ID).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if account.Password != "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Password is already set. Please change it instead!", "success": false})
+	}
+
+	channel, err := sendReauthOtp(c, user, helpers.EmailTemplateSecurityCode)
+
+	if err != nil {
+		return reauthErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "OTP successfully sent", "data": fiber.Map{"channel": channel}, "success": true})
+}
+
+func SetPassword(c *fiber.Ctx) error {
+
+	var payload *SetPasswordPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	userId := c.Locals("userId")
+
+	db := configs.DB
+	user := models.Account{}
+	result := db.Select("id", "password").First(&user, "id = ?", userId)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
+	}
+
+	if user.Password != "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Password is already set. Please change it instead!", "success": false})
+	}
+
+	if err := verifyReauthOtp(c, currentAccount(c), payload.Otp); err != nil {
+		return reauthErrorResponse(c, err)
+	}
+
+	if err := updatePassword(&user, payload.Password); err != nil {
+		log.Printf("Error setting password: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't set password", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Password set successfully", "success": true})
+}
+
+func ChangePassword(c *fiber.Ctx) error {
+
+	var payload *ChangePasswordPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	userId := c.Locals("userId")
+	sessionId := c.Locals("sessionId")
+
+	db := configs.DB
+	user := models.Account{}
+	result := db.Select("id", "password").First(&user, "id = ?", userId)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
+	}
+
+	if user.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "No password is set. Please set one first!", "success": false})
+	}
+
+	if err := checkPassword(&user, payload.CurrentPassword); err != nil {
+		return passwordErrorResponse(c, err)
+	}
+
+	if err := updatePassword(&user, payload.NewPassword); err != nil {
+		log.Printf("Error changing password: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't change password", "success": false})
+	}
+
+	// Whoever knew the old password should not stay signed in elsewhere
+	revokeSessions(db.Where("account_id = ? AND id != ?", user.ID, sessionId))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Password changed successfully", "success": true})
+}
+
+func PasswordLogin(c *fiber.Ctx) error {
+
+	var payload *PasswordLoginPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	db := configs.DB
+	userExist := models.Account{}
+
+	var result = db.Limit(1)
+
+	if payload.Mobile != "" {
+		mobile, err := helpers.NormalizePhone(payload.Mobile, payload.CountryCode)
+
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+		}
+
+		result = result.Find(&userExist, "mobile = ? AND is_mobile_verified = ?", mobile, true)
+	} else {
+		result = result.Find(&userExist, "email = ? AND is_email_verified = ?", strings.ToLower(payload.Email), true)
+	}
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials. Please try again!", "success": false})
+	}
+
+	if userExist.BlockActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
+	}
+	if userExist.BlacklistActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
+	}
+
+	if err := checkPassword(&userExist, payload.Password); err != nil {
+		recordAuthEvent(c, models.AuthEvent{AccountID: userExist.ID, Type: models.AuthEventLoginFailed, Detail: "password"}, nil)
+		return passwordErrorResponse(c, err)
+	}
+
+	return loginUser(c, &userExist, payload.FCM, payload.Platform)
+}
+
+func ForgotPassword(c *fiber.Ctx) error {
+
+	var payload *ForgotPasswordPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	// The response is the same whether or not the address belongs to an account
+	response := fiber.Map{"message": "If the email belongs to an account, a reset link has been sent", "success": true}
+
+	db := configs.DB
+	userExist := models.Account{}
+	result := db.Limit(1).Find(&userExist, "email = ? AND is_email_verified = ?", strings.ToLower(payload.Email), true)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 || userExist.BlockActive() || userExist.BlacklistActive() {
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+
+	token, err := helpers.GenerateToken(helpers.TokenTypePasswordReset, helpers.TokenClaims{
+		UserId: userExist.ID,
+		Email:  userExist.Email,
+	}, passwordResetTTL)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something bad happened on server", "success": false})
+	}
+
+	link := helpers.TokenLink(helpers.GetAppLinks().PasswordReset, token)
+
+	if err := helpers.SendEmail(userExist.Email, userExist.Lang, helpers.EmailTemplatePasswordReset, helpers.EmailData{"Link": link}); err != nil {
+		log.Printf("Error sending password reset email: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to send email", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func ResetPassword(c *fiber.Ctx) error {
+
+	var payload *ResetPasswordPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	claims, err := helpers.ParseToken(payload.Token, helpers.TokenTypePasswordReset)
+
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid or expired reset link. Please try again!", "success": false})
+	}
+
+	db := configs.DB
+	userExist := models.Account{}
+	result := db.First(&userExist, "id = ?", claims.UserId)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid or expired reset link. Please try again!", "success": false})
+	}
+
+	if userExist.BlockActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
+	}
+	if userExist.BlacklistActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
+	}
+
+	// A link is spent once the password changed after it was issued, or once the address changed
+	if userExist.Email != claims.Email || !claims.IssuedAt.Time.After(userExist.PasswordChangedAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid or expired reset link. Please try again!", "success": false})
+	}
+
+	if err := updatePassword(&userExist, payload.Password); err != nil {
+		log.Printf("Error resetting password: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't reset password", "success": false})
+	}
+
+	revokeSessions(db.Where("account_id = ?", userExist.ID))
+	db.Model(&userExist).Update("is_logged_in", false)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Password reset successfully. Please login!", "success": true})
+}
+
+func updatePassword(user *models.Account, password string) error {
+	hash, err := helpers.HashPassword(password)
+
+	if err != nil {
+		return err
+	}
+
+	return configs.DB.Model(user).Updates(map[string]interface{}{
+		"password":            hash,
+		"password_changed_at": time.Now(),
+		"updated_at":          time.Now(),
+	}).Error
+}
+
+// checkPassword compares the password, counting wrong ones towards the same lockout as OTPs.
+func checkPassword(user *models.Account, password string) error {
+	if err := helpers.CheckPasswordLogin(user.ID); err != nil {
+		return err
+	}
+
+	if helpers.ComparePassword(user.Password, password) {
+		return nil
+	}
+
+	if err := helpers.RecordPasswordFailure(user.ID); err != nil {
+		return err
+	}
+
+	return errInvalidPassword
+}
+
+func passwordErrorResponse(c *fiber.Ctx, err error) error {
+	if err == errInvalidPassword {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+	return otpErrorResponse(c, err)
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ChannelPreferencesPayload struct {
+	Security     helpers.Optional[bool] `json:"security"`
+	OrderUpdates helpers.Optional[bool] `json:"order_updates"`
+	Promotions   helpers.Optional[bool] `json:"promotions"`
+}
+type NotificationPreferencesPayload struct {
+	Sms   ChannelPreferencesPayload `json:"sms"`
+	Email ChannelPreferencesPayload `json:"email"`
+	Push  ChannelPreferencesPayload `json:"push"`
+}
+
+// UpdatePreferencesPayload changes the settings that are sent, the others stay as they are.
+type UpdatePreferencesPayload struct {
+	Notifications    NotificationPreferencesPayload `json:"notifications"`
+	Currency         helpers.Optional[string]       `json:"currency" validate:"omitempty,iso4217"`
+	Timezone         helpers.Optional[string]       `json:"timezone" validate:"omitempty,timezone"`
+	MarketingConsent helpers.Optional[bool]         `json:"marketing_consent"`
+}
+
+var (
+	notificationChannels   = []string{models.NotificationChannelSms, models.NotificationChannelEmail, models.NotificationChannelPush}
+	notificationCategories = []string{models.NotificationCategorySecurity, models.NotificationCategoryOrderUpdates, models.NotificationCategoryPromotions}
+)
+
+func GetPreferences(c *fiber.Ctx) error {
+
+	user := currentAccount(c)
+
+	preferences, err := helpers.LoadPreferences(user.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching preferences", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Preferences fetched successfully", "data": preferencesData(preferences), "success": true})
+}
+
+func UpdatePreferences(c *fiber.Ctx) error {
+
+	var payload UpdatePreferencesPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	optIns := map[string]map[string]helpers.Optional[bool]{}
+
+	for channel, channelPayload := range map[string]ChannelPreferencesPayload{
+		models.NotificationChannelSms:   payload.Notifications.Sms,
+		models.NotificationChannelEmail: payload.Notifications.Email,
+		models.NotificationChannelPush:  payload.Notifications.Push,
+	} {
+		optIns[channel] = map[string]helpers.Optional[bool]{
+			models.NotificationCategorySecurity:     channelPayload.Security,
+			models.NotificationCategoryOrderUpdates: channelPayload.OrderUpdates,
+			models.NotificationCategoryPromotions:   channelPayload.Promotions,
+		}
+	}
+
+	// Every setting has a value, null can't remove one
+	required := map[string]bool{
+		"currency":          payload.Currency.Cleared(),
+		"timezone":          payload.Timezone.Cleared(),
+		"marketing_consent": payload.MarketingConsent.Null,
+	}
+
+	for channel, categories := range optIns {
+		for category, optIn := range categories {
+			required["notifications."+channel+"."+category] = optIn.Null
+		}
+	}
+
+	if errors := helpers.Required(required); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	user := currentAccount(c)
+
+	preferences, err := helpers.LoadPreferences(user.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching preferences", "success": false})
+	}
+
+	for channel, categories := range optIns {
+		for category, optIn := range categories {
+			if optIn.Present() {
+				*preferences.Opted(channel, category) = optIn.Value
+			}
+		}
+	}
+
+	if payload.Currency.Present() {
+		preferences.Currency = payload.Currency.Value
+	}
+
+	if payload.Timezone.Present() {
+		preferences.Timezone = payload.Timezone.Value
+	}
+
+	// The timestamps record when consent was given and withdrawn, resending the same answer keeps them
+	if payload.MarketingConsent.Present() && payload.MarketingConsent.Value != preferences.MarketingConsent {
+		preferences.MarketingConsent = payload.MarketingConsent.Value
+
+		if preferences.MarketingConsent {
+			preferences.MarketingConsentAt = time.Now()
+		} else {
+			preferences.MarketingConsentWithdrawnAt = time.Now()
+		}
+	}
+
+	if err := configs.DB.Save(preferences).Error; err != nil {
+		log.Printf("Error saving preferences: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't update preferences", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Preferences updated successfully", "data": preferencesData(preferences), "success": true})
+}
+
+// preferencesData shows the opt-ins grouped by channel and category.
+func preferencesData(preferences *models.AccountPreference) fiber.Map {
+	notifications := fiber.Map{}
+
+	for _, channel := range notificationChannels {
+		categories := fiber.Map{}
+
+		for _, category := range notificationCategories {
+			categories[category] = *preferences.Opted(channel, category)
+		}
+
+		notifications[channel] = categories
+	}
+
+	return fiber.Map{
+		"notifications":                  notifications,
+		"currency":                       preferences.Currency,
+		"timezone":                       preferences.Timezone,
+		"marketing_consent":              preferences.MarketingConsent,
+		"marketing_consent_at":           preferences.MarketingConsentAt,
+		"marketing_consent_withdrawn_at": preferences.MarketingConsentWithdrawnAt,
+	}
+}
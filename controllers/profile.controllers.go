@@ -4,7 +4,10 @@ import (
 	"ecommerce/configs"
 	"ecommerce/helpers"
 	"ecommerce/models"
+	"errors"
 	"log"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -12,25 +15,41 @@ import (
 )
 
 type UpdateAccountPayload struct {
-	Name  string  `json:"name"`
-	Lang  string  `json:"lang"`
-	Photo string  `json:"photo"`
-	Lat   float64 `json:"lat"`
-	Long  float64 `json:"long"`
+	Name string  `json:"name"`
+	Lang string  `json:"lang"`
+	Lat  float64 `json:"lat"`
+	Long float64 `json:"long"`
+}
+
+// PatchProfilePayload is a JSON Merge Patch of the profile. Left out fields stay as they are, null
+// resets a field to its default.
+type PatchProfilePayload struct {
+	Name helpers.Optional[string]  `json:"name" validate:"omitempty,max=100"`
+	Lang helpers.Optional[string]  `json:"lang" validate:"omitempty,max=10"`
+	Lat  helpers.Optional[float64] `json:"lat" validate:"omitempty,min=-90,max=90"`
+	Long helpers.Optional[float64] `json:"long" validate:"omitempty,min=-180,max=180"`
 }
 
 type UpdateEmailPayload struct {
 	Email string `json:"email" validate:"required,email"`
 }
-type VerifyEmailPayload struct {
-	Token string `json:"token" validate:"required"`
+type VerifyEmailQuery struct {
+	Token string `query:"token" validate:"required"`
 }
 
+// Reasons a verification link is refused, the redirect carries them in the reason parameter.
+const (
+	emailVerifyInvalid = "invalid"
+	emailVerifyExpired = "expired"
+	emailVerifyTaken   = "taken"
+	emailVerifyBlocked = "blocked"
+)
+
 type AddAddressPayload struct {
 	IsDefault         bool    `json:"is_default" validate:"boolean"`
 	FullName          string  `json:"full_name" validate:"omitempty,min=3,max=100"`
-	PhoneNumber       string  `json:"phone_number" validate:"omitempty,number,max=10,min=10"`
-	CountryCode       string  `json:"country_code" validate:"omitempty,number,max=3"`
+	PhoneNumber       string  `json:"phone_number" validate:"omitempty,max=20"`
+	CountryCode       string  `json:"country_code" validate:"omitempty,max=4"`
 	AddressLine1      string  `json:"address_line1" validate:"omitempty,min=15,max=255"`
 	AddressLine2      string  `json:"address_line2" validate:"omitempty,min=15,max=255"`
 	PostalCode        string  `json:"postal_code" validate:"required,number,max=6,min=6"`
@@ -46,8 +65,8 @@ type AddAddressPayload struct {
 type UpdateAddressPayload struct {
 	IsDefault         bool    `json:"is_default" validate:"omitempty,boolean"`
 	FullName          string  `json:"full_name" validate:"omitempty,min=3,max=100"`
-	PhoneNumber       string  `json:"phone_number" validate:"omitempty,number,max=10,min=10"`
-	CountryCode       string  `json:"country_code" validate:"omitempty,number,max=3"`
+	PhoneNumber       string  `json:"phone_number" validate:"omitempty,max=20"`
+	CountryCode       string  `json:"country_code" validate:"omitempty,max=4"`
 	AddressLine1      string  `json:"address_line1" validate:"omitempty,min=15,max=255"`
 	AddressLine2      string  `json:"address_line2" validate:"omitempty,min=15,max=255"`
 	PostalCode        string  `json:"postal_code" validate:"omitempty,number,max=6,min=6"`
@@ -61,6 +80,29 @@ type UpdateAddressPayload struct {
 	Long              float64 `json:"long" validate:"omitempty,number"`
 }
 
+// PatchAddressPayload is a JSON Merge Patch of an address. Left out fields stay as they are, null
+// clears the optional ones and is refused for the rest.
+type PatchAddressPayload struct {
+	IsDefault         helpers.Optional[bool]    `json:"is_default"`
+	FullName          helpers.Optional[string]  `json:"full_name" validate:"omitempty,min=3,max=100"`
+	PhoneNumber       helpers.Optional[string]  `json:"phone_number" validate:"omitempty,max=20"`
+	CountryCode       helpers.Optional[string]  `json:"country_code" validate:"omitempty,max=4"`
+	AddressLine1      helpers.Optional[string]  `json:"address_line1" validate:"omitempty,min=15,max=255"`
+	AddressLine2      helpers.Optional[string]  `json:"address_line2" validate:"omitempty,min=15,max=255"`
+	PostalCode        helpers.Optional[string]  `json:"postal_code" validate:"omitempty,number,max=6,min=6"`
+	City              helpers.Optional[string]  `json:"city" validate:"omitempty,min=3,max=100"`
+	State             helpers.Optional[string]  `json:"state" validate:"omitempty,min=3,max=100"`
+	Country           helpers.Optional[string]  `json:"country" validate:"omitempty,min=3,max=100"`
+	IsShippingAddress helpers.Optional[bool]    `json:"is_shipping_address"`
+	IsBillingAddress  helpers.Optional[bool]    `json:"is_billing_address"`
+	AddressTitle      helpers.Optional[string]  `json:"address_title" validate:"omitempty,min=3,max=100"`
+	Lat               helpers.Optional[float64] `json:"lat" validate:"omitempty,min=-90,max=90"`
+	Long              helpers.Optional[float64] `json:"long" validate:"omitempty,min=-180,max=180"`
+}
+
+// Columns of an address shown to its owner.
+var addressFields = []string{"id", "is_default", "full_name", "phone_number", "country_code", "address_line1", "address_line2", "city", "state", "country", "postal_code", "is_shipping_address", "is_billing_address", "address_title", "lat", "long", "created_at", "updated_at"}
+
 type GetAddressQuery struct {
 	Limit int    `json:"limit" validate:"omitempty,number,min=1,max=100"`
 	Page  int    `json:"page" validate:"omitempty,number"`
@@ -69,42 +111,33 @@ type GetAddressQuery struct {
 
 func GetProfile(c *fiber.Ctx) error {
 
-	userId := c.Locals("userId")
-
-	db := configs.DB
-	user := models.Account{}
-	result := db.Select("id", "name", "email", "is_blocked", "mobile", "is_blacklisted", "lang", "country_code", "is_mobile_verified", "is_email_verified", "profile_image").First(&user, "id = ?", userId)
+	user := currentAccount(c)
 
-	if result.Error != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Please login", "success": false})
+	if !user.IsVerified() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unverified account please verify", "success": false})
 	}
 
-	if user.IsBlocked {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Account blocked! Please contact support", "success": false})
-	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User profile fetched successfully", "data": profileData(user), "success": true})
 
-	if user.IsBlacklisted {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Account blacklisted! Please contact support", "success": false})
-	}
+}
 
-	if !user.IsMobileVerified {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unverified account please verify", "success": false})
+// profileData is the profile as GetProfile shows it.
+func profileData(user *models.Account) fiber.Map {
+	return fiber.Map{
+		"name":                  user.Name,
+		"id":                    user.ID,
+		"email":                 user.Email,
+		"pending_email":         user.PendingEmail,
+		"mobile":                user.Mobile,
+		"is_blocked":            user.BlockActive(),
+		"is_blacklisted":        user.BlacklistActive(),
+		"is_mobile_verified":    user.IsMobileVerified,
+		"is_email_verified":     user.IsEmailVerified,
+		"lang":                  user.Lang,
+		"country_code":          user.CountryCode,
+		"profile_image":         profileImageURLs(user.ProfileImage),
+		"deletion_scheduled_at": user.DeletionScheduledAt,
 	}
-
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User profile fetched successfully", "data": fiber.Map{
-		"name":               user.Name,
-		"id":                 user.ID,
-		"email":              user.Email,
-		"mobile":             user.Mobile,
-		"is_blocked":         user.IsBlocked,
-		"is_blacklisted":     user.IsBlacklisted,
-		"is_mobile_verified": user.IsMobileVerified,
-		"is_email_verified":  user.IsEmailVerified,
-		"lang":               user.Lang,
-		"country_code":       user.CountryCode,
-		"profile_image":      user.ProfileImage,
-	}, "success": true})
-
 }
 func UpdateProfile(c *fiber.Ctx) error {
 
@@ -119,28 +152,14 @@ func UpdateProfile(c *fiber.Ctx) error {
 
 	}
 
-	userId := c.Locals("userId")
-
 	db := configs.DB
-	user := models.Account{}
-	result := db.First(&user, "id = ?", userId)
-
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something went wrong", "success": false})
-	}
-
-	if result.RowsAffected == 0 {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unauthorized access. Please login", "success": false})
-	}
+	user := currentAccount(c)
 
 	userUpdate := models.Account{}
 
 	if payload.Name != "" {
 		userUpdate.Name = payload.Name
 	}
-	if payload.Photo != "" {
-		userUpdate.ProfileImage = payload.Photo
-	}
 
 	if payload.Lang != "" {
 		userUpdate.Lang = payload.Lang
@@ -154,17 +173,20 @@ func UpdateProfile(c *fiber.Ctx) error {
 		userUpdate.Long = payload.Long
 	}
 
-	if err := db.Model(&user).Updates(&userUpdate).Error; err != nil {
+	if err := db.Model(user).Updates(&userUpdate).Error; err != nil {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't update user profile", "success": false})
 	}
 
+	helpers.InvalidateAccount(user.ID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User profile updated successfully", "success": true})
 
 }
 
-func UpdateEmail(c *fiber.Ctx) error {
+// PatchProfile applies a JSON Merge Patch to the profile and returns the updated profile.
+func PatchProfile(c *fiber.Ctx) error {
 
-	var payload *UpdateEmailPayload
+	var payload PatchProfilePayload
 
 	if err := c.BodyParser(&payload); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
@@ -174,110 +196,235 @@ func UpdateEmail(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
 	}
 
-	userId := c.Locals("userId")
-
 	db := configs.DB
-	userExist := models.Account{}
-	result := db.First(&userExist, "id = ?", userId)
+	user := currentAccount(c)
 
-	if result.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	updates := map[string]interface{}{}
+
+	if payload.Name.Set {
+		updates["name"] = payload.Name.Value
 	}
 
-	if result.RowsAffected == 0 {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Account does not exist. Please register!", "success": false})
+	if payload.Lang.Set {
+		if payload.Lang.Null || payload.Lang.Value == "" {
+			updates["lang"] = "en"
+		} else {
+			updates["lang"] = payload.Lang.Value
+		}
+	}
+
+	if payload.Lat.Set {
+		updates["lat"] = payload.Lat.Value
 	}
 
-	if userExist.IsBlocked {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
+	if payload.Long.Set {
+		updates["long"] = payload.Long.Value
+	}
+
+	if len(updates) > 0 {
+		updates["updated_at"] = time.Now()
+
+		if err := db.Model(&models.Account{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't update user profile", "success": false})
+		}
+
+		helpers.InvalidateAccount(user.ID)
 	}
-	if userExist.IsBlacklisted {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
+
+	updated := models.Account{}
+
+	if err := db.First(&updated, "id = ?", user.ID).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
 	}
-	if !userExist.IsMobileVerified {
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User profile updated successfully", "data": profileData(&updated), "success": true})
+}
+
+func UpdateEmail(c *fiber.Ctx) error {
+
+	var payload *UpdateEmailPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	db := configs.DB
+	userExist := currentAccount(c)
+
+	if !userExist.IsVerified() {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You are not verified! Please verify your account!", "data": fiber.Map{"id": userExist.ID, "isMobileVerified": userExist.IsMobileVerified}, "success": false})
 	}
 
+	// Email login looks addresses up in lower case
+	payload.Email = strings.ToLower(payload.Email)
+
+	if payload.Email == userExist.Email && userExist.IsEmailVerified {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "This is already your email!", "success": false})
+	}
+
+	var taken int64
+
+	if err := db.Model(&models.Account{}).Where("email = ? AND id != ?", payload.Email, userExist.ID).Count(&taken).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Email is already in use!", "success": false})
+	}
+
 	// Generate token based on email and send email
-	token, err := helpers.GenerateToken(helpers.TokenClaims{
+	token, err := helpers.GenerateToken(helpers.TokenTypeEmailVerify, helpers.TokenClaims{
 		UserId: userExist.ID,
 		Email:  payload.Email,
-		Exp:    time.Now().Add(5 * time.Minute).Unix(), // 5 minutes from now
-	})
+	}, 5*time.Minute) // 5 minutes from now
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something bad happened on server", "success": false})
 	}
 
-	// Send email
-	err = helpers.SendEmail(token, userExist.Email)
+	link := helpers.TokenLink(helpers.GetAppLinks().EmailVerify, token)
+
+	// The link goes to the new address, that is the one being verified
+	err = helpers.SendEmail(payload.Email, userExist.Lang, helpers.EmailTemplateEmailVerify, helpers.EmailData{"Link": link})
 
 	if err != nil {
+		log.Printf("Error sending verification email: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to send email", "success": false})
 	}
 
-	userExist.Email = payload.Email
-	userExist.IsEmailVerified = false
+	// The current email stays in use until the new one is verified. A newer request replaces the
+	// pending email, which makes links sent for the old one useless.
+	if err := db.Model(&models.Account{}).Where("id = ?", userExist.ID).Update("pending_email", payload.Email).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't update email", "success": false})
+	}
+
+	helpers.InvalidateAccount(userExist.ID)
 
-	db.Save(&userExist)
+	recordAuthEvent(c, models.AuthEvent{AccountID: userExist.ID, Type: models.AuthEventEmailChange, Detail: "requested"}, nil)
 
 	// Return response
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Email updated and verification email sent", "success": true})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Verification email sent. Your email changes once you verify it", "success": true})
 
 }
+
+// VerifyEmail is opened from the link in the verification email, so it answers with a page for the
+// browser, or redirects to EMAIL_VERIFY_REDIRECT_URL when the frontend shows the result itself.
 func VerifyEmail(c *fiber.Ctx) error {
 
-	var payload *VerifyEmailPayload
+	var query VerifyEmailQuery
 
-	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
-	}
+	lang := c.AcceptsLanguages(helpers.PageLanguages()...)
 
-	if errors := helpers.ValidateStruct(payload); errors != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	if err := c.QueryParser(&query); err != nil || query.Token == "" {
+		return emailVerificationResponse(c, lang, "", emailVerifyInvalid)
 	}
 
-	parseToken, err := helpers.ParseToken(payload.Token)
+	parseToken, err := helpers.ParseToken(query.Token, helpers.TokenTypeEmailVerify)
 
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": err.Error(), "success": false})
+		if helpers.IsTokenExpired(err) {
+			return emailVerificationResponse(c, lang, "", emailVerifyExpired)
+		}
+		return emailVerificationResponse(c, lang, "", emailVerifyInvalid)
 	}
 
-	userId := parseToken.UserId
-
 	db := configs.DB
 	userExist := models.Account{}
-	result := db.First(&userExist, "id = ?", userId)
+	result := db.Limit(1).Find(&userExist, "id = ?", parseToken.UserId)
 
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+		log.Printf("Error fetching account: %v", result.Error)
+		return c.Status(fiber.StatusBadGateway).SendString("Something bad happened. Please try again!")
 	}
 
 	if result.RowsAffected == 0 {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Account does not exist. Please register!", "success": false})
+		return emailVerificationResponse(c, lang, "", emailVerifyInvalid)
 	}
 
-	if userExist.IsBlocked {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
+	lang = userExist.Lang
+
+	if userExist.BlockActive() || userExist.BlacklistActive() {
+		return emailVerificationResponse(c, lang, "", emailVerifyBlocked)
 	}
-	if userExist.IsBlacklisted {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
+
+	if !userExist.IsVerified() || parseToken.Email == "" {
+		return emailVerificationResponse(c, lang, "", emailVerifyInvalid)
 	}
-	if !userExist.IsMobileVerified {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You are not verified! Please verify your account!", "data": fiber.Map{"id": userExist.ID, "isMobileVerified": userExist.IsMobileVerified}, "success": false})
+
+	// The link only promotes the email it was sent to while that is still the pending one. Emails
+	// written directly by the old flow are still unverified and may be verified in place.
+	update := db.Model(&models.Account{}).
+		Where("id = ? AND (pending_email = ? OR (email = ? AND is_email_verified = ?))", userExist.ID, parseToken.Email, parseToken.Email, false).
+		Updates(map[string]interface{}{
+			"email":             parseToken.Email,
+			"pending_email":     "",
+			"is_email_verified": true,
+			"updated_at":        time.Now(),
+		})
+
+	if errors.Is(update.Error, gorm.ErrDuplicatedKey) {
+		return emailVerificationResponse(c, lang, "", emailVerifyTaken)
 	}
 
-	if userExist.Email != parseToken.Email {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid token. Failed to verify email!", "success": false})
+	if update.Error != nil {
+		log.Printf("Error verifying email: %v", update.Error)
+		return c.Status(fiber.StatusBadGateway).SendString("Something bad happened. Please try again!")
 	}
 
-	userExist.IsEmailVerified = true
+	if update.RowsAffected == 0 {
+		return emailVerificationResponse(c, lang, "", emailVerifyInvalid)
+	}
 
-	db.Save(&userExist)
+	helpers.InvalidateAccount(userExist.ID)
 
-	// Return response
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Email verified successfully", "success": true})
+	recordAuthEvent(c, models.AuthEvent{AccountID: userExist.ID, Type: models.AuthEventEmailChange, Detail: "verified"}, nil)
 
+	return emailVerificationResponse(c, lang, parseToken.Email, "")
+}
+
+// emailVerificationResponse answers a verification link, an empty reason means the email was verified.
+func emailVerificationResponse(c *fiber.Ctx, lang string, email string, reason string) error {
+
+	status := fiber.StatusOK
+	if reason != "" {
+		status = fiber.StatusBadRequest
+	}
+
+	if redirectUrl := helpers.GetAppLinks().EmailVerifyRedirect; redirectUrl != "" {
+		values := url.Values{}
+
+		if reason == "" {
+			values.Set("status", "verified")
+		} else {
+			values.Set("status", "failed")
+			values.Set("reason", reason)
+		}
+
+		separator := "?"
+		if strings.Contains(redirectUrl, "?") {
+			separator = "&"
+		}
+
+		return c.Redirect(redirectUrl+separator+values.Encode(), fiber.StatusFound)
+	}
+
+	page, err := helpers.RenderPage(helpers.PageTemplateEmailVerification, lang, helpers.PageData{
+		"Success": reason == "",
+		"Reason":  reason,
+		"Email":   email,
+	})
+
+	if err != nil {
+		log.Printf("Error rendering email verification page: %v", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Something bad happened. Please try again!")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(status).SendString(page)
 }
 
 func AddAddress(c *fiber.Ctx) error {
@@ -292,19 +439,8 @@ func AddAddress(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
 	}
 
-	userId := c.Locals("userId")
-
 	db := configs.DB
-	user := models.Account{}
-	result := db.First(&user, "id = ?", userId)
-
-	if result.RowsAffected == 0 {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Account does not exist. Please register!", "success": false})
-	}
-
-	if result.Error != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
-	}
+	user := currentAccount(c)
 
 	userAddress := models.Address{
 		AccountID: user.ID,
@@ -328,6 +464,18 @@ func AddAddress(c *fiber.Ctx) error {
 		userAddress.CountryCode = user.CountryCode
 	}
 
+	// Accounts from Google or Apple sign in may have no number to fall back to
+	if userAddress.PhoneNumber != "" {
+		phone, err := helpers.ParsePhone(userAddress.PhoneNumber, userAddress.CountryCode)
+
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+		}
+
+		userAddress.PhoneNumber = phone.E164()
+		userAddress.CountryCode = phone.CountryCode
+	}
+
 	if payload.AddressLine1 != "" {
 		userAddress.AddressLine1 = payload.AddressLine1
 	}
@@ -435,6 +583,12 @@ func UpdateAddress(c *fiber.Ctx) error {
 		address.CountryCode = payload.CountryCode
 	}
 
+	if payload.PhoneNumber != "" || payload.CountryCode != "" {
+		if err := setAddressPhone(&address, payload.PhoneNumber); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+		}
+	}
+
 	if payload.AddressLine1 != "" {
 		address.AddressLine1 = payload.AddressLine1
 	}
@@ -501,6 +655,151 @@ func UpdateAddress(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Address updated successfully", "success": true})
 }
+
+// PatchAddress applies a JSON Merge Patch to an address and returns the updated address.
+func PatchAddress(c *fiber.Ctx) error {
+
+	var payload PatchAddressPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	// Every address needs these, they can be changed but not removed
+	if errors := helpers.Required(map[string]bool{
+		"is_default":          payload.IsDefault.Null,
+		"full_name":           payload.FullName.Cleared(),
+		"phone_number":        payload.PhoneNumber.Cleared(),
+		"country_code":        payload.CountryCode.Cleared(),
+		"address_line1":       payload.AddressLine1.Cleared(),
+		"postal_code":         payload.PostalCode.Cleared(),
+		"city":                payload.City.Cleared(),
+		"state":               payload.State.Cleared(),
+		"country":             payload.Country.Cleared(),
+		"is_shipping_address": payload.IsShippingAddress.Null,
+		"is_billing_address":  payload.IsBillingAddress.Null,
+	}); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	userId := c.Locals("userId")
+	addressId := c.Params("addressId")
+
+	db := configs.DB
+	address := models.Address{}
+	result := db.Limit(1).Find(&address, "id = ? AND account_id = ? AND is_deleted = false", addressId, userId)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching address", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Address does not exist. Please add address!", "success": false})
+	}
+
+	updates := map[string]interface{}{}
+
+	for column, field := range map[string]helpers.Optional[string]{
+		"full_name":     payload.FullName,
+		"address_line1": payload.AddressLine1,
+		"address_line2": payload.AddressLine2,
+		"postal_code":   payload.PostalCode,
+		"city":          payload.City,
+		"state":         payload.State,
+		"country":       payload.Country,
+		"address_title": payload.AddressTitle,
+	} {
+		if field.Set {
+			updates[column] = field.Value
+		}
+	}
+
+	for column, field := range map[string]helpers.Optional[bool]{
+		"is_default":          payload.IsDefault,
+		"is_shipping_address": payload.IsShippingAddress,
+		"is_billing_address":  payload.IsBillingAddress,
+	} {
+		if field.Set {
+			updates[column] = field.Value
+		}
+	}
+
+	for column, field := range map[string]helpers.Optional[float64]{
+		"lat":  payload.Lat,
+		"long": payload.Long,
+	} {
+		if field.Set {
+			updates[column] = field.Value
+		}
+	}
+
+	if payload.PhoneNumber.Set || payload.CountryCode.Set {
+		if payload.CountryCode.Present() {
+			address.CountryCode = payload.CountryCode.Value
+		}
+
+		if err := setAddressPhone(&address, payload.PhoneNumber.Value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+		}
+
+		updates["phone_number"] = address.PhoneNumber
+		updates["country_code"] = address.CountryCode
+	}
+
+	if len(updates) > 0 {
+		updates["updated_at"] = time.Now()
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if payload.IsDefault.Value {
+				if err := tx.Model(&models.Address{}).Where("account_id = ? AND id != ?", userId, address.ID).Update("is_default", false).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Model(&models.Address{}).Where("id = ?", address.ID).Updates(updates).Error
+		})
+
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Update address failed. Please try again!", "success": false})
+		}
+	}
+
+	updated := models.Address{}
+
+	if err := db.Select(addressFields).First(&updated, "id = ?", address.ID).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching address", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Address updated successfully", "data": updated, "success": true})
+}
+
+// setAddressPhone normalizes the number against the address's country code. Without a new number a
+// new country code applies to the national part of the stored number.
+func setAddressPhone(address *models.Address, number string) error {
+	if number == "" {
+		number = address.PhoneNumber
+
+		if stored, err := helpers.ParsePhone(address.PhoneNumber, ""); err == nil {
+			number = stored.National
+		}
+	}
+
+	phone, err := helpers.ParsePhone(number, address.CountryCode)
+
+	if err != nil {
+		return err
+	}
+
+	address.PhoneNumber = phone.E164()
+	address.CountryCode = phone.CountryCode
+
+	return nil
+}
+
 func DeleteAddress(c *fiber.Ctx) error {
 
 	userId := c.Locals("userId")
@@ -587,9 +886,7 @@ func GetAllAddresses(c *fiber.Ctx) error {
 		defaultQuery = defaultQuery.Order(Sort)
 	}
 
-	selectQuery := []string{"id", "is_default", "full_name", "phone_number", "country_code", "address_line1", "address_line2", "city", "state", "country", "postal_code", "is_shipping_address", "is_billing_address", "address_title", "lat", "long", "created_at", "updated_at"}
-
-	result := defaultQuery.Select(selectQuery).Find(&addresses)
+	result := defaultQuery.Select(addressFields).Find(&addresses)
 
 	if result.Error != nil {
 		log.Println(result.Error)
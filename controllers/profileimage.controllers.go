@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ServeFileQuery struct {
+	Expires   string `query:"expires" validate:"required"`
+	Signature string `query:"signature" validate:"required"`
+}
+
+// UploadProfileImage takes the image from the "image" field of a multipart form. The upload is
+// re-encoded in every variant, which also drops its metadata, and replaces the previous image.
+func UploadProfileImage(c *fiber.Ctx) error {
+
+	fileHeader, err := c.FormFile("image")
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Please choose an image to upload!", "success": false})
+	}
+
+	if fileHeader.Size > helpers.MaxImageBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"message": helpers.ErrImageTooLarge.Error(), "success": false})
+	}
+
+	file, err := fileHeader.Open()
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": helpers.ErrImageInvalid.Error(), "success": false})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, helpers.MaxImageBytes+1))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": helpers.ErrImageInvalid.Error(), "success": false})
+	}
+
+	images, err := helpers.ProcessImage(data, helpers.ProfileImageVariants)
+
+	switch err {
+	case nil:
+	case helpers.ErrImageTooLarge:
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"message": err.Error(), "success": false})
+	case helpers.ErrImageType:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"message": err.Error(), "success": false})
+	case helpers.ErrImageDimension, helpers.ErrImageInvalid:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	default:
+		log.Printf("Error processing profile image: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Couldn't process image", "success": false})
+	}
+
+	db := configs.DB
+	user := currentAccount(c)
+	storage := helpers.GetStorage()
+
+	folder, err := helpers.NewProfileImageFolder(user.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something bad happened on server", "success": false})
+	}
+
+	var stored []string
+	original := ""
+
+	for _, image := range images {
+		key := helpers.ProfileImageKey(folder, image.Variant, image.Extension)
+
+		if err := storage.Put(key, image.Data, image.ContentType); err != nil {
+			log.Printf("Error storing profile image: %v", err)
+			deleteStoredFiles(stored)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't upload image", "success": false})
+		}
+
+		stored = append(stored, key)
+
+		if image.Variant == "original" {
+			original = key
+		}
+	}
+
+	// The previous image is read again here, the cached account may be stale
+	previous := models.Account{}
+
+	if err := db.Select("id", "profile_image").First(&previous, "id = ?", user.ID).Error; err != nil {
+		deleteStoredFiles(stored)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't update profile image", "success": false})
+	}
+
+	if err := db.Model(&models.Account{}).Where("id = ?", user.ID).Updates(map[string]interface{}{"profile_image": original, "updated_at": time.Now()}).Error; err != nil {
+		deleteStoredFiles(stored)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't update profile image", "success": false})
+	}
+
+	helpers.InvalidateAccount(user.ID)
+
+	deleteProfileImage(previous.ProfileImage)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Profile image updated successfully", "data": fiber.Map{"profile_image": profileImageURLs(original)}, "success": true})
+}
+
+func DeleteProfileImage(c *fiber.Ctx) error {
+
+	db := configs.DB
+	user := currentAccount(c)
+
+	previous := models.Account{}
+
+	if err := db.Select("id", "profile_image").First(&previous, "id = ?", user.ID).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if previous.ProfileImage == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "You have no profile image!", "success": false})
+	}
+
+	if err := db.Model(&models.Account{}).Where("id = ?", user.ID).Updates(map[string]interface{}{"profile_image": "", "updated_at": time.Now()}).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't remove profile image", "success": false})
+	}
+
+	helpers.InvalidateAccount(user.ID)
+
+	deleteProfileImage(previous.ProfileImage)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Profile image removed successfully", "success": true})
+}
+
+// ServeFile serves files of the local storage driver. The signature of the link takes the place of
+// authentication, other drivers hand out their own links.
+func ServeFile(c *fiber.Ctx) error {
+
+	local, ok := helpers.GetStorage().(*helpers.LocalStorage)
+
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "File does not exist!", "success": false})
+	}
+
+	var query ServeFileQuery
+
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(query); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	key, err := url.PathUnescape(c.Params("*"))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid file", "success": false})
+	}
+
+	if err := helpers.VerifySignedURL(helpers.StorageResource(key), query.Expires, query.Signature); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	file, err := local.Path(key)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid file", "success": false})
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "File does not exist!", "success": false})
+	}
+
+	// Links expire, nothing in between should keep the file longer than the link lives
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+
+	return c.SendFile(file)
+}
+
+// profileImageURLs returns a link to every variant of the stored image. Values from before uploads
+// are passed on as they are.
+func profileImageURLs(profileImage string) fiber.Map {
+	if profileImage == "" {
+		return nil
+	}
+
+	keys := helpers.ProfileImageKeys(profileImage)
+
+	if keys == nil {
+		return fiber.Map{"original": profileImage}
+	}
+
+	urls := fiber.Map{}
+
+	for variant, key := range keys {
+		link, err := helpers.StorageURL(key)
+
+		if err != nil {
+			log.Printf("Error signing profile image url: %v", err)
+			continue
+		}
+
+		urls[variant] = link
+	}
+
+	return urls
+}
+
+// deleteProfileImage removes every variant of a replaced image, failures only leave orphaned files.
+func deleteProfileImage(profileImage string) {
+	keys := helpers.ProfileImageKeys(profileImage)
+
+	files := make([]string, 0, len(keys))
+	for _, key := range keys {
+		files = append(files, key)
+	}
+
+	deleteStoredFiles(files)
+}
+
+func deleteStoredFiles(keys []string) {
+	for _, key := range keys {
+		if err := helpers.GetStorage().Delete(key); err != nil {
+			log.Printf("Error deleting stored file %s: %v", key, err)
+		}
+	}
+}
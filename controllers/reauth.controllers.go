@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Sensitive changes need more than an access token, which may have been stolen. The user proves again
+// that they control the account's verified mobile number or email with a code.
+const reauthOtpTTL = 10 * time.Minute
+
+var errNoReauthChannel = errors.New("Please verify your mobile number or email first!")
+
+// sendReauthOtp sends the code by SMS, accounts without a verified number get it by email rendered with
+// the template. It returns the channel the code went to.
+func sendReauthOtp(c *fiber.Ctx, user *models.Account, emailTemplate string) (string, error) {
+	channel, ok := reauthOtpChannel(user)
+
+	if !ok {
+		return "", errNoReauthChannel
+	}
+
+	if channel == models.OtpChannelSms {
+		return channel, sendAccountOtp(c, user, reauthOtpTTL)
+	}
+
+	otp, err := helpers.GenerateOtp()
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := storeAccountOtp(c, user, models.OtpChannelEmailReauth, otp, reauthOtpTTL); err != nil {
+		return "", err
+	}
+
+	if err := helpers.SendEmail(user.Email, user.Lang, emailTemplate, helpers.EmailData{"Code": otp}); err != nil {
+		log.Printf("Error sending %s email: %v", emailTemplate, err)
+		return "", errOtpDelivery
+	}
+
+	return channel, nil
+}
+
+// verifyReauthOtp checks a code sent by sendReauthOtp.
+func verifyReauthOtp(c *fiber.Ctx, user *models.Account, otp string) error {
+	channel, ok := reauthOtpChannel(user)
+
+	if !ok {
+		return errNoReauthChannel
+	}
+
+	if channel == models.OtpChannelEmail {
+		channel = models.OtpChannelEmailReauth
+	}
+
+	return verifyChannelOtp(c, user, channel, otp)
+}
+
+func reauthOtpChannel(user *models.Account) (string, bool) {
+	if user.Mobile != "" && user.IsMobileVerified {
+		return models.OtpChannelSms, true
+	}
+
+	if user.Email != "" && user.IsEmailVerified {
+		return models.OtpChannelEmail, true
+	}
+
+	return "", false
+}
+
+func reauthErrorResponse(c *fiber.Ctx, err error) error {
+	if err == errNoReauthChannel {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+	return otpErrorResponse(c, err)
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+type GrantRolePayload struct {
+	Role string `json:"role" validate:"required,max=30"`
+}
+
+func GetRoles(c *fiber.Ctx) error {
+
+	db := configs.DB
+	var roles []models.Role
+
+	if err := db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching roles", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Roles fetched successfully", "data": roles, "count": len(roles), "success": true})
+}
+
+func GetAccountRoles(c *fiber.Ctx) error {
+
+	accountId := c.Params("accountId")
+
+	db := configs.DB
+	user := models.Account{}
+	result := db.Select("id").Limit(1).Find(&user, "id = ?", accountId)
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Account does not exist!", "success": false})
+	}
+
+	var accountRoles []models.AccountRole
+
+	if err := db.Preload("Role.Permissions").Where("account_id = ?", user.ID).Find(&accountRoles).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching roles", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Roles fetched successfully", "data": accountRoles, "count": len(accountRoles), "success": true})
+}
+
+// GrantRole adds a role to an account. It shows up in the account's access token after the next refresh.
+func GrantRole(c *fiber.Ctx) error {
+
+	var payload *GrantRolePayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	adminId := c.Locals("userId").(string)
+	accountId := c.Params("accountId")
+
+	db := configs.DB
+	user := models.Account{}
+	result := db.Select("id").Limit(1).Find(&user, "id = ?", accountId)
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Account does not exist!", "success": false})
+	}
+
+	role := models.Role{}
+	result = db.Limit(1).Find(&role, "name = ?", payload.Role)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Role does not exist!", "success": false})
+	}
+
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.AccountRole{AccountID: user.ID, RoleID: role.ID, GrantedBy: adminId})
+
+	if result.Error != nil {
+		log.Printf("Error granting role: %v", result.Error)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Granting role failed. Please try again!", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Account already has this role!", "success": false})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Role granted successfully", "success": true})
+}
+
+// RevokeRole removes a role from an account. The account's sessions are revoked as well because the
+// access tokens it holds still carry the role.
+func RevokeRole(c *fiber.Ctx) error {
+
+	adminId := c.Locals("userId").(string)
+	accountId := c.Params("accountId")
+	roleName := c.Params("role")
+
+	// Nobody should be able to lock themselves out of the admin endpoints by accident
+	if accountId == adminId && roleName == models.RoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "You can't revoke your own admin role!", "success": false})
+	}
+
+	db := configs.DB
+	user := models.Account{}
+	result := db.Select("id").Limit(1).Find(&user, "id = ?", accountId)
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Account does not exist!", "success": false})
+	}
+
+	role := models.Role{}
+	result = db.Limit(1).Find(&role, "name = ?", roleName)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Role does not exist!", "success": false})
+	}
+
+	result = db.Where("account_id = ? AND role_id = ?", user.ID, role.ID).Delete(&models.AccountRole{})
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Revoking role failed. Please try again!", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Account does not have this role!", "success": false})
+	}
+
+	if err := revokeSessions(db.Where("account_id = ?", user.ID)); err != nil {
+		log.Printf("Error revoking sessions after role change: %v", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Role revoked successfully", "success": true})
+}
+
+// accountAccess returns the names of the account's roles and of the permissions they grant.
+func accountAccess(accountId string) ([]string, []string, error) {
+	db := configs.DB
+
+	var roles []string
+
+	err := db.Table("account_roles").
+		Joins("JOIN roles ON roles.id = account_roles.role_id").
+		Where("account_roles.account_id = ?", accountId).
+		Order("roles.name").
+		Pluck("roles.name", &roles).Error
+
+	if err != nil || len(roles) == 0 {
+		return nil, nil, err
+	}
+
+	var permissions []string
+
+	err = db.Table("account_roles").
+		Joins("JOIN role_permissions ON role_permissions.role_id = account_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("account_roles.account_id = ?", accountId).
+		Distinct().
+		Order("permissions.name").
+		Pluck("permissions.name", &permissions).Error
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return roles, permissions, nil
+}
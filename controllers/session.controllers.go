@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	accessTokenTTL  = time.Hour * 24  // 1 day
+	refreshTokenTTL = time.Hour * 168 // 7 days
+)
+
+type RenameSessionPayload struct {
+	DeviceName string `json:"device_name" validate:"required,min=1,max=30"`
+}
+
+func GetSessions(c *fiber.Ctx) error {
+
+	userId := c.Locals("userId")
+	sessionId := c.Locals("sessionId")
+
+	db := configs.DB
+	var sessions []models.UserLogin
+
+	result := db.Select("id", "device_name", "platform", "lang", "last_seen_at", "created_at").Where("account_id = ? AND is_active = ?", userId, true).Order("last_seen_at desc").Find(&sessions)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching sessions", "success": false})
+	}
+
+	data := make([]fiber.Map, 0, len(sessions))
+
+	for _, session := range sessions {
+		data = append(data, fiber.Map{
+			"id":           session.ID,
+			"device_name":  session.DeviceName,
+			"platform":     session.Platform,
+			"lang":         session.Lang,
+			"last_seen_at": session.LastSeenAt,
+			"created_at":   session.CreatedAt,
+			"current":      session.ID == sessionId,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Sessions fetched successfully", "data": data, "count": len(data), "success": true})
+}
+
+func RenameSession(c *fiber.Ctx) error {
+
+	var payload *RenameSessionPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	userId := c.Locals("userId")
+	sessionId, err := c.ParamsInt("sessionId")
+
+	if err != nil || sessionId <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid session id", "success": false})
+	}
+
+	db := configs.DB
+	result := db.Model(&models.UserLogin{}).Where("id = ? AND account_id = ? AND is_active = ?", sessionId, userId, true).Updates(map[string]interface{}{
+		"device_name": payload.DeviceName,
+		"updated_at":  time.Now(),
+	})
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Renaming device failed. Please try again!", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Session does not exist!", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Device renamed successfully", "success": true})
+}
+
+func RevokeSession(c *fiber.Ctx) error {
+
+	userId := c.Locals("userId")
+	sessionId, err := c.ParamsInt("sessionId")
+
+	if err != nil || sessionId <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid session id", "success": false})
+	}
+
+	db := configs.DB
+	session := models.UserLogin{}
+	result := db.Select("id").Limit(1).Find(&session, "id = ? AND account_id = ? AND is_active = ?", sessionId, userId, true)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened while fetching session", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Session does not exist!", "success": false})
+	}
+
+	if err := revokeSessions(db.Where("id = ?", session.ID)); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Revoking session failed. Please try again!", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Session revoked successfully", "success": true})
+}
+
+func RevokeOtherSessions(c *fiber.Ctx) error {
+
+	userId := c.Locals("userId")
+	sessionId := c.Locals("sessionId")
+
+	db := configs.DB
+
+	if err := revokeSessions(db.Where("account_id = ? AND id != ?", userId, sessionId)); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Revoking sessions failed. Please try again!", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Other sessions revoked successfully", "success": true})
+}
+
+// issueSessionTokens signs a new access/refresh pair bound to the login and stores the hash of the
+// refresh token on it, which makes every refresh token issued before for this login stale. The access
+// token carries the account's current roles and permissions.
+// The caller persists the login.
+func issueSessionTokens(user *models.Account, userLogin *models.UserLogin) (string, string, error) {
+	now := time.Now()
+
+	refreshToken, err := helpers.GenerateToken(helpers.TokenTypeRefresh, helpers.TokenClaims{
+		UserId:    user.ID,
+		SessionId: userLogin.ID,
+	}, refreshTokenTTL)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	roles, permissions, err := accountAccess(user.ID)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := helpers.GenerateToken(helpers.TokenTypeAccess, helpers.TokenClaims{
+		UserId:      user.ID,
+		SessionId:   userLogin.ID,
+		Roles:       roles,
+		Permissions: permissions,
+	}, accessTokenTTL)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	userLogin.RefreshToken = helpers.HashToken(refreshToken)
+	userLogin.IsExpired = now.Add(refreshTokenTTL)
+	userLogin.IsActive = true
+	userLogin.LastSeenAt = now
+
+	return accessToken, refreshToken, nil
+}
+
+// loginUser finishes a successful first login step. Accounts with two factor authentication get a
+// challenge token for the second step instead of a session.
+func loginUser(c *fiber.Ctx, user *models.Account, fcm string, platform string) error {
+
+	enabled, err := isTwoFactorEnabled(user.ID)
+
+	if err != nil {
+		log.Printf("Error checking two factor: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
+	}
+
+	if enabled {
+		challengeToken, err := helpers.GenerateToken(helpers.TokenTypeTwoFactor, helpers.TokenClaims{
+			UserId: user.ID,
+			Device: helpers.DeviceBinding(fcm, platform),
+		}, twoFactorChallengeTTL)
+
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two factor authentication required", "data": fiber.Map{"twoFactorRequired": true, "challengeToken": challengeToken}, "success": true})
+	}
+
+	return startSession(c, user, fcm, platform)
+}
+
+// startSession creates the session for the device and writes the login response. Every login gets a
+// new session, so tokens of a session that was signed out never become valid again. Other sessions of
+// the account on the same platform are signed out, and the user is alerted when the device is new.
+func startSession(c *fiber.Ctx, user *models.Account, fcm string, platform string) error {
+
+	db := configs.DB
+
+	previous := models.UserLogin{}
+
+	result := db.Select("id", "device_name", "lang").Order("id desc").Limit(1).Find(&previous, models.UserLogin{AccountID: user.ID, FCM: fcm, Platform: platform})
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
+	}
+
+	newDevice := result.RowsAffected == 0
+
+	// The device keeps the name and language it was given before
+	userLogin := models.UserLogin{AccountID: user.ID, FCM: fcm, Platform: platform, DeviceName: previous.DeviceName, Lang: previous.Lang}
+
+	var accessToken, refreshToken string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&userLogin).Error; err != nil {
+			return err
+		}
+
+		var err error
+
+		accessToken, refreshToken, err = issueSessionTokens(user, &userLogin)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Save(&userLogin).Error; err != nil {
+			return err
+		}
+
+		// Earlier sessions of this device are on the same platform, they go too
+		return revokeSessions(tx.Where("id != ? AND account_id = ? AND platform = ?", userLogin.ID, user.ID, platform))
+	})
+
+	if err != nil {
+		log.Printf("Error starting session: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't login user", "success": false})
+	}
+
+	db.Model(&models.Account{}).Where("id = ?", user.ID).Update("is_logged_in", true)
+
+	recordAuthEvent(c, models.AuthEvent{AccountID: user.ID, Type: models.AuthEventLogin}, &userLogin)
+
+	if newDevice {
+		notifyNewDevice(c, user, &userLogin)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User successfully logged in", "data": fiber.Map{"accessToken": accessToken, "refreshToken": refreshToken, "user": fiber.Map{"id": user.ID, "name": user.Name, "email": user.Email}}, "success": true})
+}
+
+// rotateRefreshToken swaps the presented refresh token for a new pair. A token that is validly signed
+// but no longer current was already rotated out, so someone is replaying it and the whole session is
+// revoked.
+func rotateRefreshToken(user *models.Account, claims *helpers.TokenClaims, refreshToken string) (string, string, bool, error) {
+
+	db := configs.DB
+
+	presentedHash := helpers.HashToken(refreshToken)
+
+	userLogin := models.UserLogin{}
+
+	result := db.Limit(1).Find(&userLogin, "id = ? AND account_id = ?", claims.SessionId, user.ID)
+
+	if result.Error != nil {
+		return "", "", false, result.Error
+	}
+
+	if result.RowsAffected == 0 || !userLogin.IsActive {
+		return "", "", false, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(presentedHash), []byte(userLogin.RefreshToken)) != 1 {
+		log.Printf("Refresh token reuse detected for session %d, revoking", userLogin.ID)
+		revokeSessions(db.Where("id = ?", userLogin.ID))
+		return "", "", false, nil
+	}
+
+	accessToken, newRefreshToken, err := issueSessionTokens(user, &userLogin)
+
+	if err != nil {
+		return "", "", false, err
+	}
+
+	// Only one of two concurrent refreshes with the same token may win, the loser's token is then stale
+	update := db.Model(&models.UserLogin{}).Where("id = ? AND refresh_token = ? AND is_active = ?", userLogin.ID, presentedHash, true).Updates(map[string]interface{}{
+		"refresh_token": userLogin.RefreshToken,
+		"is_expired":    userLogin.IsExpired,
+		"last_seen_at":  userLogin.LastSeenAt,
+		"updated_at":    time.Now(),
+	})
+
+	if update.Error != nil {
+		return "", "", false, update.Error
+	}
+
+	if update.RowsAffected == 0 {
+		log.Printf("Refresh token reuse detected for session %d, revoking", userLogin.ID)
+		revokeSessions(db.Where("id = ?", userLogin.ID))
+		return "", "", false, nil
+	}
+
+	return accessToken, newRefreshToken, true, nil
+}
+
+// revokeSessions signs out every active login matched by the scope. Access tokens of these sessions
+// are rejected by IsAuthenticated from now on.
+func revokeSessions(scope *gorm.DB) error {
+	return scope.Model(&models.UserLogin{}).Where("is_active = ?", true).Updates(map[string]interface{}{
+		"is_active":  false,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// currentAccount returns the account IsAuthenticated loaded for the request. It comes from a cache and
+// has no password hash.
+func currentAccount(c *fiber.Ctx) *models.Account {
+	account, _ := c.Locals("account").(*models.Account)
+	return account
+}
@@ -0,0 +1,419 @@
+package controllers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const twoFactorChallengeTTL = 5 * time.Minute
+
+var errInvalidTwoFactorCode = errors.New("Invalid authentication code. Please try again!")
+
+type TwoFactorCodePayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,number"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,min=10,max=11"`
+}
+type TwoFactorLoginPayload struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,number"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code,omitempty,min=10,max=11"`
+	FCM            string `json:"fcm" validate:"required"`
+	Platform       string `json:"platform" validate:"required"`
+}
+
+func GetTwoFactorStatus(c *fiber.Ctx) error {
+
+	userId := c.Locals("userId")
+
+	db := configs.DB
+	twoFactor := models.AccountTwoFactor{}
+	result := db.Limit(1).Find(&twoFactor, "account_id = ? AND is_enabled = ?", userId, true)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	var recoveryCodesLeft int64
+	db.Model(&models.TwoFactorRecoveryCode{}).Where("account_id = ? AND is_used = ?", userId, false).Count(&recoveryCodesLeft)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two factor status fetched successfully", "data": fiber.Map{
+		"enabled":             result.RowsAffected > 0,
+		"enabled_at":          twoFactor.EnabledAt,
+		"recovery_codes_left": recoveryCodesLeft,
+	}, "success": true})
+}
+
+// EnrollTwoFactor creates a new secret. It only takes effect once a code from it is confirmed.
+func EnrollTwoFactor(c *fiber.Ctx) error {
+
+	db := configs.DB
+	user := currentAccount(c)
+
+	twoFactor := models.AccountTwoFactor{}
+	result := db.Limit(1).Find(&twoFactor, "account_id = ?", user.ID)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if twoFactor.IsEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Two factor authentication is already enabled!", "success": false})
+	}
+
+	secret, err := helpers.GenerateTOTPSecret()
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something bad happened on server", "success": false})
+	}
+
+	sealedSecret, err := helpers.EncryptSecret(secret)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Something bad happened on server", "success": false})
+	}
+
+	twoFactor.AccountID = user.ID
+	twoFactor.Secret = sealedSecret
+	twoFactor.LastUsedStep = 0
+
+	if err := db.Save(&twoFactor).Error; err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't start enrollment", "success": false})
+	}
+
+	accountName := user.Mobile
+	if accountName == "" {
+		accountName = user.Email
+	}
+
+	issuer := helpers.TOTPIssuer()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Scan the code with your authenticator app and confirm it", "data": fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": helpers.TOTPURI(secret, issuer, accountName),
+	}, "success": true})
+}
+
+func ConfirmTwoFactor(c *fiber.Ctx) error {
+
+	var payload *TwoFactorCodePayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	userId := c.Locals("userId").(string)
+
+	db := configs.DB
+	twoFactor := models.AccountTwoFactor{}
+	result := db.Limit(1).Find(&twoFactor, "account_id = ?", userId)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Please start two factor enrollment first!", "success": false})
+	}
+
+	if twoFactor.IsEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Two factor authentication is already enabled!", "success": false})
+	}
+
+	// Recovery codes do not exist yet, only a code from the new secret confirms it
+	if err := verifyTwoFactorCode(&twoFactor, payload.Code, ""); err != nil {
+		return twoFactorErrorResponse(c, err)
+	}
+
+	var codes []string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&twoFactor).Updates(map[string]interface{}{"is_enabled": true, "enabled_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userId)
+		return err
+	})
+
+	if err != nil {
+		log.Printf("Error enabling two factor: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't enable two factor authentication", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two factor authentication enabled. Store the recovery codes somewhere safe!", "data": fiber.Map{"recovery_codes": codes}, "success": true})
+}
+
+func DisableTwoFactor(c *fiber.Ctx) error {
+
+	var payload *TwoFactorCodePayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	userId := c.Locals("userId")
+
+	db := configs.DB
+	twoFactor := models.AccountTwoFactor{}
+	result := db.Limit(1).Find(&twoFactor, "account_id = ? AND is_enabled = ?", userId, true)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Two factor authentication is not enabled!", "success": false})
+	}
+
+	if err := verifyTwoFactorCode(&twoFactor, payload.Code, payload.RecoveryCode); err != nil {
+		return twoFactorErrorResponse(c, err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", userId).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&twoFactor).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't disable two factor authentication", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two factor authentication disabled", "success": true})
+}
+
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+
+	var payload *TwoFactorCodePayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	userId := c.Locals("userId").(string)
+
+	db := configs.DB
+	twoFactor := models.AccountTwoFactor{}
+	result := db.Limit(1).Find(&twoFactor, "account_id = ? AND is_enabled = ?", userId, true)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Two factor authentication is not enabled!", "success": false})
+	}
+
+	if err := verifyTwoFactorCode(&twoFactor, payload.Code, payload.RecoveryCode); err != nil {
+		return twoFactorErrorResponse(c, err)
+	}
+
+	var codes []string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userId)
+		return err
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Couldn't regenerate recovery codes", "success": false})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Recovery codes regenerated. The old codes no longer work!", "data": fiber.Map{"recovery_codes": codes}, "success": true})
+}
+
+// TwoFactorLogin is the second login step, it exchanges the challenge token and a code for a session.
+func TwoFactorLogin(c *fiber.Ctx) error {
+
+	var payload *TwoFactorLoginPayload
+
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+
+	if errors := helpers.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"errors": errors, "success": false})
+	}
+
+	claims, err := helpers.ParseToken(payload.ChallengeToken, helpers.TokenTypeTwoFactor)
+
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Login expired. Please login again!", "success": false})
+	}
+
+	// The challenge only finishes the login on the device that passed the first step
+	if claims.Device != helpers.DeviceBinding(payload.FCM, payload.Platform) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Login expired. Please login again!", "success": false})
+	}
+
+	db := configs.DB
+	userExist := models.Account{}
+	result := db.First(&userExist, "id = ?", claims.UserId)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Login expired. Please login again!", "success": false})
+	}
+
+	if userExist.BlockActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlockedReason, "success": false})
+	}
+	if userExist.BlacklistActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": userExist.IsBlacklistedReason, "success": false})
+	}
+
+	twoFactor := models.AccountTwoFactor{}
+	result = db.Limit(1).Find(&twoFactor, "account_id = ? AND is_enabled = ?", userExist.ID, true)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	// 2FA was switched off in the meantime, the first step alone is enough now
+	if result.RowsAffected > 0 {
+		if err := verifyTwoFactorCode(&twoFactor, payload.Code, payload.RecoveryCode); err != nil {
+			recordAuthEvent(c, models.AuthEvent{AccountID: userExist.ID, Type: models.AuthEventLoginFailed, Detail: "two_factor"}, nil)
+			return twoFactorErrorResponse(c, err)
+		}
+	}
+
+	// A challenge starts one session, replaying it would skip the second step
+	if err := helpers.ConsumeToken(configs.DB, claims); err != nil {
+		if errors.Is(err, helpers.ErrTokenUsed) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Login expired. Please login again!", "success": false})
+		}
+
+		log.Printf("Error consuming two factor challenge: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Something bad happened", "success": false})
+	}
+
+	return startSession(c, &userExist, payload.FCM, payload.Platform)
+}
+
+func isTwoFactorEnabled(accountId string) (bool, error) {
+	var count int64
+	err := configs.DB.Model(&models.AccountTwoFactor{}).Where("account_id = ? AND is_enabled = ?", accountId, true).Count(&count).Error
+	return count > 0, err
+}
+
+// verifyTwoFactorCode accepts either a TOTP code or an unused recovery code. Accepted codes are spent
+// and wrong ones count towards a lockout.
+func verifyTwoFactorCode(twoFactor *models.AccountTwoFactor, code string, recoveryCode string) error {
+	db := configs.DB
+
+	if err := helpers.CheckTwoFactorLogin(twoFactor.AccountID); err != nil {
+		return err
+	}
+
+	if code != "" {
+		secret, err := helpers.DecryptSecret(twoFactor.Secret)
+
+		if err != nil {
+			return err
+		}
+
+		if step, ok := helpers.ValidateTOTP(secret, code, time.Now(), twoFactor.LastUsedStep); ok {
+			// The step condition makes a code usable only once even with concurrent requests
+			update := db.Model(&models.AccountTwoFactor{}).Where("id = ? AND last_used_step < ?", twoFactor.ID, step).Update("last_used_step", step)
+
+			if update.Error != nil {
+				return update.Error
+			}
+
+			if update.RowsAffected == 1 {
+				twoFactor.LastUsedStep = step
+				return nil
+			}
+		}
+	} else if recoveryCode != "" {
+		recoveryCode = helpers.NormalizeRecoveryCode(recoveryCode)
+
+		var codes []models.TwoFactorRecoveryCode
+
+		if err := db.Where("account_id = ? AND is_used = ?", twoFactor.AccountID, false).Find(&codes).Error; err != nil {
+			return err
+		}
+
+		for _, stored := range codes {
+			if !helpers.CompareOtp(stored.CodeHash, recoveryCode) {
+				continue
+			}
+
+			update := db.Model(&models.TwoFactorRecoveryCode{}).Where("id = ? AND is_used = ?", stored.ID, false).Updates(map[string]interface{}{"is_used": true, "used_at": time.Now()})
+
+			if update.Error != nil {
+				return update.Error
+			}
+
+			if update.RowsAffected == 1 {
+				return nil
+			}
+		}
+	}
+
+	if err := helpers.RecordTwoFactorFailure(twoFactor.AccountID); err != nil {
+		return err
+	}
+
+	return errInvalidTwoFactorCode
+}
+
+// replaceRecoveryCodes drops the account's recovery codes and stores a fresh set, which is returned in
+// plain text exactly once.
+func replaceRecoveryCodes(tx *gorm.DB, accountId string) ([]string, error) {
+	codes, err := helpers.GenerateRecoveryCodes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("account_id = ?", accountId).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.TwoFactorRecoveryCode, 0, len(codes))
+
+	for _, code := range codes {
+		codeHash, err := helpers.HashOtp(code)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, models.TwoFactorRecoveryCode{AccountID: accountId, CodeHash: codeHash})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func twoFactorErrorResponse(c *fiber.Ctx, err error) error {
+	if err == errInvalidTwoFactorCode {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error(), "success": false})
+	}
+	return otpErrorResponse(c, err)
+}
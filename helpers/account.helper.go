@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/models"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Short enough that a missed invalidation heals quickly, long enough to spare the database on
+// every authenticated request.
+const accountCacheTTL = 30 * time.Second
+
+// LoadAccount returns the account from the cache and falls back to the database. The cached copy
+// has no password hash, controllers that need it load the account themselves.
+func LoadAccount(accountId string) (*models.Account, error) {
+	key := accountCacheKey(accountId)
+
+	if configs.Memcache != nil {
+		if value, err := configs.Memcache.Get(key); err == nil {
+			account := models.Account{}
+
+			if err := json.Unmarshal(value, &account); err == nil {
+				return &account, nil
+			}
+		}
+	}
+
+	account := models.Account{}
+
+	if err := configs.DB.First(&account, "id = ?", accountId).Error; err != nil {
+		return nil, err
+	}
+
+	if configs.Memcache != nil {
+		if value, err := json.Marshal(&account); err == nil {
+			if err := configs.Memcache.Set(key, value, accountCacheTTL); err != nil {
+				log.Printf("Error caching account: %v", err)
+			}
+		}
+	}
+
+	return &account, nil
+}
+
+// InvalidateAccount drops the cached account. It has to be called after every change to the
+// account's status or profile.
+func InvalidateAccount(accountId string) {
+	if configs.Memcache == nil {
+		return
+	}
+
+	// A miss means there was nothing to drop
+	configs.Memcache.Delete(accountCacheKey(accountId))
+}
+
+func accountCacheKey(accountId string) string {
+	return "account:" + accountId
+}
@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"ecommerce/configs"
+	"fmt"
+	"net/url"
+)
+
+// AppLinks are the pages emails and redirects point users to.
+type AppLinks struct {
+	EmailLogin          string // the app's page that signs in with the token of a login link
+	PasswordReset       string // the app's page that sets a new password with the reset token
+	EmailVerify         string // our endpoint behind the verification link
+	EmailVerifyRedirect string // where verification links end up, empty to show our own page
+	SessionRevoke       string // our endpoint behind the link in a new device alert
+}
+
+var appLinks AppLinks
+
+// InitAppLinks reads the link targets from the env config once on startup.
+func InitAppLinks(env configs.EnvConfig) error {
+	links := AppLinks{
+		EmailLogin:          env.EMAIL_LOGIN_URL,
+		PasswordReset:       env.PASSWORD_RESET_URL,
+		EmailVerify:         env.EMAIL_VERIFY_URL,
+		EmailVerifyRedirect: env.EMAIL_VERIFY_REDIRECT_URL,
+		SessionRevoke:       env.SESSION_REVOKE_URL,
+	}
+
+	for name, value := range map[string]string{
+		"EMAIL_LOGIN_URL":    links.EmailLogin,
+		"PASSWORD_RESET_URL": links.PasswordReset,
+		"EMAIL_VERIFY_URL":   links.EmailVerify,
+		"SESSION_REVOKE_URL": links.SessionRevoke,
+	} {
+		if err := checkLinkURL(name, value); err != nil {
+			return err
+		}
+	}
+
+	if links.EmailVerifyRedirect != "" {
+		if err := checkLinkURL("EMAIL_VERIFY_REDIRECT_URL", links.EmailVerifyRedirect); err != nil {
+			return err
+		}
+	}
+
+	appLinks = links
+
+	return nil
+}
+
+// GetAppLinks returns the active link targets.
+func GetAppLinks() AppLinks {
+	return appLinks
+}
+
+// TokenLink appends the token to a link target.
+func TokenLink(target string, token string) string {
+	return fmt.Sprintf("%s?token=%s", target, url.QueryEscape(token))
+}
+
+func checkLinkURL(name string, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is not set", name)
+	}
+
+	if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s must be an absolute URL", name)
+	}
+
+	return nil
+}
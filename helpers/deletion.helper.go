@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"ecommerce/configs"
+	"time"
+)
+
+// AccountDeletion controls when requested account deletions are carried out.
+type AccountDeletion struct {
+	GracePeriod time.Duration // time the user has to cancel a deletion
+	JobInterval time.Duration // how often the deletion job looks for due accounts
+}
+
+var accountDeletion = AccountDeletion{
+	GracePeriod: 30 * 24 * time.Hour,
+	JobInterval: time.Hour,
+}
+
+// InitAccountDeletion reads the deletion settings from the env config, unset values keep their defaults.
+func InitAccountDeletion(env configs.EnvConfig) error {
+	settings := accountDeletion
+
+	if err := parseDurationEnv("ACCOUNT_DELETION_GRACE", env.ACCOUNT_DELETION_GRACE, &settings.GracePeriod); err != nil {
+		return err
+	}
+	if err := parseDurationEnv("ACCOUNT_DELETION_INTERVAL", env.ACCOUNT_DELETION_INTERVAL, &settings.JobInterval); err != nil {
+		return err
+	}
+	if settings.JobInterval == 0 {
+		settings.JobInterval = time.Hour
+	}
+
+	accountDeletion = settings
+
+	return nil
+}
+
+// GetAccountDeletion returns the active settings.
+func GetAccountDeletion() AccountDeletion {
+	return accountDeletion
+}
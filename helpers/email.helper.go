@@ -1,8 +1,335 @@
 package helpers
 
-import "fmt"
+import (
+	"bytes"
+	"crypto/rand"
+	"ecommerce/configs"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
 
-func SendEmail(email string, text string) error {
-	fmt.Println("Email: ", email, "Text: ", text)
+const (
+	defaultEmailFrom     = "no-reply@localhost"
+	defaultEmailAttempts = 3
+	defaultEmailBackoff  = 500 * time.Millisecond
+
+	// The memory outbox drops its oldest messages beyond this, so a long running process can't grow it
+	// without bound
+	memoryEmailLimit = 1000
+)
+
+// EmailSender delivers a rendered email. Every mail provider we plug in has to implement this.
+type EmailSender interface {
+	SendEmail(message EmailMessage) error
+}
+
+// EmailMessage is a rendered email with a text and an HTML body.
+type EmailMessage struct {
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Subject  string    `json:"subject"`
+	Text     string    `json:"text"`
+	HTML     string    `json:"html"`
+	Template string    `json:"template"`
+	Data     EmailData `json:"data"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// EmailData is handed to the templates.
+type EmailData map[string]interface{}
+
+var (
+	emailSender   EmailSender = NewMemoryEmailSender()
+	emailFrom                 = defaultEmailFrom
+	emailAttempts             = defaultEmailAttempts
+	emailBackoff              = defaultEmailBackoff
+)
+
+// InitEmailSender selects the email driver from the env config. It is called once on startup.
+func InitEmailSender(env configs.EnvConfig) error {
+	var sender EmailSender
+
+	switch env.EMAIL_DRIVER {
+	case "", "local":
+		// Without a maildir the messages are only kept in memory
+		if env.EMAIL_MAILDIR == "" {
+			sender = NewMemoryEmailSender()
+		} else {
+			sender = NewMaildirEmailSender(env.EMAIL_MAILDIR)
+		}
+	case "memory":
+		sender = NewMemoryEmailSender()
+	case "maildir":
+		if env.EMAIL_MAILDIR == "" {
+			return errors.New("EMAIL_MAILDIR is not set")
+		}
+		sender = NewMaildirEmailSender(env.EMAIL_MAILDIR)
+	case "smtp":
+		if env.SMTP_HOST == "" {
+			return errors.New("SMTP_HOST is not set")
+		}
+		sender = &SMTPEmailSender{
+			Host:     env.SMTP_HOST,
+			Port:     valueOr(env.SMTP_PORT, "587"),
+			Username: env.SMTP_USERNAME,
+			Password: env.SMTP_PASSWORD,
+		}
+	default:
+		return fmt.Errorf("unknown EMAIL_DRIVER: %s", env.EMAIL_DRIVER)
+	}
+
+	// The local drivers never deliver anything, codes and links would silently go nowhere
+	if env.GO_ENV == "production" && env.EMAIL_DRIVER != "smtp" {
+		return errors.New("EMAIL_DRIVER must be smtp in production")
+	}
+
+	attempts := defaultEmailAttempts
+	if err := parseIntEnv("EMAIL_MAX_ATTEMPTS", env.EMAIL_MAX_ATTEMPTS, &attempts); err != nil {
+		return err
+	}
+
+	if err := loadEmailTemplates(); err != nil {
+		return err
+	}
+
+	emailSender = sender
+	emailFrom = valueOr(env.EMAIL_FROM, defaultEmailFrom)
+	emailAttempts = attempts
+
+	return nil
+}
+
+// SetEmailSender replaces the active driver, tests use it to install a memory outbox.
+func SetEmailSender(sender EmailSender) {
+	emailSender = sender
+}
+
+// GetEmailSender returns the active driver.
+func GetEmailSender() EmailSender {
+	return emailSender
+}
+
+// SendEmail renders the template in the language of the recipient and delivers it. Failed deliveries
+// are retried with a doubling backoff, rejections by the mail server are not.
+func SendEmail(to string, lang string, template string, data EmailData) error {
+	if emailSender == nil {
+		return errors.New("email sender is not initialized")
+	}
+
+	message, err := RenderEmail(template, lang, data)
+	if err != nil {
+		return err
+	}
+
+	message.From = emailFrom
+	message.To = to
+
+	backoff := emailBackoff
+
+	for attempt := 1; ; attempt++ {
+		message.SentAt = time.Now()
+
+		err = emailSender.SendEmail(message)
+		if err == nil || attempt >= emailAttempts || isPermanentEmailError(err) {
+			return err
+		}
+
+		log.Printf("Error sending %s email (attempt %d): %v", template, attempt, err)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isPermanentEmailError reports SMTP 5xx replies, sending the same message again won't help.
+func isPermanentEmailError(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code >= 500
+}
+
+// BuildEmail encodes the message as a multipart/alternative MIME message.
+func BuildEmail(message EmailMessage) ([]byte, error) {
+	var buffer bytes.Buffer
+	body := multipart.NewWriter(&buffer)
+
+	messageId := make([]byte, 16)
+	if _, err := rand.Read(messageId); err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(message.From, "@"); at >= 0 {
+		domain = message.From[at+1:]
+	}
+
+	header := []string{
+		"From: " + message.From,
+		"To: " + message.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date: " + message.SentAt.Format(time.RFC1123Z),
+		"Message-ID: <" + hex.EncodeToString(messageId) + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + body.Boundary(),
+	}
+
+	buffer.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", message.Text},
+		{"text/html; charset=UTF-8", message.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+
+		writer, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// SMTPEmailSender delivers through an SMTP server, upgrading to TLS with STARTTLS when the server
+// offers it.
+type SMTPEmailSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+func (s *SMTPEmailSender) SendEmail(message EmailMessage) error {
+	raw, err := BuildEmail(message)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, message.From, []string{message.To}, raw)
+}
+
+// MemoryEmailSender keeps the last messages in memory so tests can read links and codes back.
+type MemoryEmailSender struct {
+	mu       sync.Mutex
+	messages []EmailMessage
+}
+
+func NewMemoryEmailSender() *MemoryEmailSender {
+	return &MemoryEmailSender{}
+}
+
+func (m *MemoryEmailSender) SendEmail(message EmailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.messages) >= memoryEmailLimit {
+		m.messages = append(m.messages[:0], m.messages[len(m.messages)-memoryEmailLimit+1:]...)
+	}
+
+	m.messages = append(m.messages, message)
 	return nil
 }
+
+// Messages returns a copy of the outbox.
+func (m *MemoryEmailSender) Messages() []EmailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]EmailMessage, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+// LastEmail returns the most recent message sent to the address.
+func (m *MemoryEmailSender) LastEmail(to string) (EmailMessage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+	return EmailMessage{}, false
+}
+
+// Reset empties the outbox.
+func (m *MemoryEmailSender) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
+
+// MaildirEmailSender stores every message as a file in a maildir, so a local mail client can read it.
+type MaildirEmailSender struct {
+	Dir string
+}
+
+func NewMaildirEmailSender(dir string) *MaildirEmailSender {
+	return &MaildirEmailSender{Dir: dir}
+}
+
+func (m *MaildirEmailSender) SendEmail(message EmailMessage) error {
+	raw, err := BuildEmail(message)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(m.Dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+
+	unique := make([]byte, 8)
+	if _, err := rand.Read(unique); err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%d_%s.%s", message.SentAt.Unix(), os.Getpid(), hex.EncodeToString(unique), hostname)
+
+	// Messages are written to tmp and moved, so readers of new never see half a message
+	tmpPath := filepath.Join(m.Dir, "tmp", name)
+
+	if err := os.WriteFile(tmpPath, raw, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(m.Dir, "new", name))
+}
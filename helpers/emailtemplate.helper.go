@@ -0,0 +1,151 @@
+package helpers
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Email templates, rendered in the recipient's Account.Lang.
+const (
+	EmailTemplatePasswordReset   = "password_reset"
+	EmailTemplateEmailVerify     = "email_verify"
+	EmailTemplateEmailLoginLink  = "email_login_link"
+	EmailTemplateEmailLoginCode  = "email_login_code"
+	EmailTemplateNewDeviceLogin  = "new_device_login"
+	EmailTemplateDeletionCode    = "account_deletion_code"
+	EmailTemplateDeletionDue     = "account_deletion_scheduled"
+	EmailTemplateDataExportReady = "data_export_ready"
+	EmailTemplateSecurityCode    = "security_code" // confirms a sensitive change made while signed in
+)
+
+// Languages without their own templates get these.
+const defaultEmailLang = "en"
+
+//go:embed templates/email
+var emailTemplateFiles embed.FS
+
+// Every <lang>/<name>.txt defines the subject and the text body, <lang>/<name>.html defines the
+// subject again and the content block of layout.html.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var (
+	emailTemplates     map[string]map[string]*emailTemplate // lang -> name -> template
+	emailTemplatesErr  error
+	emailTemplatesOnce sync.Once
+)
+
+func loadEmailTemplates() error {
+	emailTemplatesOnce.Do(func() {
+		emailTemplates, emailTemplatesErr = parseEmailTemplates(emailTemplateFiles)
+	})
+	return emailTemplatesErr
+}
+
+func parseEmailTemplates(files fs.FS) (map[string]map[string]*emailTemplate, error) {
+	root := "templates/email"
+
+	layout, err := htmltemplate.ParseFS(files, path.Join(root, "layout.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	langs, err := fs.ReadDir(files, root)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]map[string]*emailTemplate{}
+
+	for _, lang := range langs {
+		if !lang.IsDir() {
+			continue
+		}
+
+		textFiles, err := fs.Glob(files, path.Join(root, lang.Name(), "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+
+		templates[lang.Name()] = map[string]*emailTemplate{}
+
+		for _, textFile := range textFiles {
+			name := strings.TrimSuffix(path.Base(textFile), ".txt")
+
+			text, err := texttemplate.ParseFS(files, textFile)
+			if err != nil {
+				return nil, err
+			}
+
+			html, err := layout.Clone()
+			if err != nil {
+				return nil, err
+			}
+
+			if html, err = html.ParseFS(files, strings.TrimSuffix(textFile, ".txt")+".html"); err != nil {
+				return nil, err
+			}
+
+			templates[lang.Name()][name] = &emailTemplate{text: text, html: html}
+		}
+	}
+
+	if len(templates[defaultEmailLang]) == 0 {
+		return nil, fmt.Errorf("no %s email templates found", defaultEmailLang)
+	}
+
+	return templates, nil
+}
+
+// RenderEmail renders the subject and both bodies of a template. Unknown languages fall back to English.
+func RenderEmail(name string, lang string, data EmailData) (EmailMessage, error) {
+	if err := loadEmailTemplates(); err != nil {
+		return EmailMessage{}, err
+	}
+
+	lang = strings.ToLower(lang)
+
+	tmpl, ok := emailTemplates[lang][name]
+	if !ok {
+		lang = defaultEmailLang
+		tmpl, ok = emailTemplates[lang][name]
+	}
+	if !ok {
+		return EmailMessage{}, fmt.Errorf("unknown email template: %s", name)
+	}
+
+	values := EmailData{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Lang"] = lang
+
+	var subject, text, html bytes.Buffer
+
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return EmailMessage{}, err
+	}
+	if err := tmpl.text.Execute(&text, values); err != nil {
+		return EmailMessage{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout.html", values); err != nil {
+		return EmailMessage{}, err
+	}
+
+	return EmailMessage{
+		Subject:  strings.TrimSpace(subject.String()),
+		Text:     strings.TrimSpace(text.String()) + "\n",
+		HTML:     html.String(),
+		Template: name,
+		Data:     data,
+	}, nil
+}
@@ -0,0 +1,170 @@
+package helpers
+
+import (
+	"archive/zip"
+	"ecommerce/configs"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DataExportSettings controls where export archives are kept and for how long.
+type DataExportSettings struct {
+	Dir string        // archives are written here
+	TTL time.Duration // how long an archive and its download link live
+	URL string        // base of the download links, the export id and /download are appended
+}
+
+var dataExportSettings = DataExportSettings{
+	Dir: "tmp/exports",
+	TTL: 72 * time.Hour,
+}
+
+// InitDataExports reads the export settings from the env config, unset values keep their defaults.
+func InitDataExports(env configs.EnvConfig) error {
+	settings := dataExportSettings
+
+	if env.DATA_EXPORT_DIR != "" {
+		settings.Dir = env.DATA_EXPORT_DIR
+	}
+	if err := parseDurationEnv("DATA_EXPORT_TTL", env.DATA_EXPORT_TTL, &settings.TTL); err != nil {
+		return err
+	}
+	if err := checkLinkURL("DATA_EXPORT_URL", env.DATA_EXPORT_URL); err != nil {
+		return err
+	}
+	settings.URL = env.DATA_EXPORT_URL
+
+	dataExportSettings = settings
+
+	return nil
+}
+
+// GetDataExportSettings returns the active settings.
+func GetDataExportSettings() DataExportSettings {
+	return dataExportSettings
+}
+
+// WriteExportTable adds <name>.json and <name>.csv to the archive. rows is a slice of models, the
+// columns are their JSON fields. Fields hidden from JSON, like password hashes, and relations are left
+// out.
+func WriteExportTable(archive *zip.Writer, name string, rows interface{}) error {
+	columns, records, err := exportRecords(rows)
+	if err != nil {
+		return err
+	}
+
+	jsonFile, err := archive.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(jsonFile)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(records); err != nil {
+		return err
+	}
+
+	csvFile, err := archive.Create(name + ".csv")
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(csvFile)
+
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		line := make([]string, len(columns))
+
+		for i, column := range columns {
+			line[i] = exportCell(record[column])
+		}
+
+		if err := writer.Write(line); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exportRecords(rows interface{}) ([]string, []map[string]interface{}, error) {
+	value := reflect.ValueOf(rows)
+
+	if value.Kind() != reflect.Slice {
+		return nil, nil, fmt.Errorf("export rows must be a slice, got %s", value.Kind())
+	}
+
+	elemType := value.Type().Elem()
+
+	if elemType.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("export rows must be structs, got %s", elemType.Kind())
+	}
+
+	var columns []string
+	var fields []int
+
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+
+		// Relations are exported as tables of their own
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			continue
+		}
+		if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		columns = append(columns, name)
+		fields = append(fields, i)
+	}
+
+	records := make([]map[string]interface{}, 0, value.Len())
+
+	for i := 0; i < value.Len(); i++ {
+		record := make(map[string]interface{}, len(columns))
+
+		for j, field := range fields {
+			record[columns[j]] = value.Index(i).Field(field).Interface()
+		}
+
+		records = append(records, record)
+	}
+
+	return columns, records, nil
+}
+
+func exportCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ";")
+	}
+
+	return fmt.Sprint(value)
+}
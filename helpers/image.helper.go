@@ -0,0 +1,350 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	MaxImageBytes  = 3 << 20     // stays below the 4MB request body limit
+	maxImagePixels = 4096 * 4096 // decoded images are held in memory, width * height * 4 bytes
+	jpegQuality    = 90
+
+	// Each decode holds up to 64MB, more uploads than this wait for their turn
+	maxConcurrentDecodes = 2
+)
+
+var imageDecodeSlots = make(chan struct{}, maxConcurrentDecodes)
+
+var (
+	ErrImageTooLarge  = errors.New("image is larger than 3MB")
+	ErrImageType      = errors.New("only JPEG and PNG images are allowed")
+	ErrImageDimension = errors.New("image dimensions are too large")
+	ErrImageInvalid   = errors.New("image could not be read")
+)
+
+// ImageVariant is a size an upload is stored in.
+type ImageVariant struct {
+	Name   string
+	Size   int  // the longer side, or both sides for squares
+	Square bool // center crop to a square before resizing
+}
+
+// ProfileImageVariants are stored for every profile image, "original" is kept as the reference in
+// Account.ProfileImage.
+var ProfileImageVariants = []ImageVariant{
+	{Name: "original", Size: 1024},
+	{Name: "256", Size: 256, Square: true},
+	{Name: "64", Size: 64, Square: true},
+}
+
+const profileImagePrefix = "profile/"
+
+// NewProfileImageFolder returns a fresh folder for an upload of the account. Every upload gets its
+// own, so links to a replaced image stop resolving once its files are deleted.
+func NewProfileImageFolder(accountId string) (string, error) {
+	id, err := randomTokenId()
+	if err != nil {
+		return "", err
+	}
+	return profileImagePrefix + accountId + "/" + id, nil
+}
+
+// ProfileImageKey is the storage key of one variant in an upload folder.
+func ProfileImageKey(folder string, variant string, extension string) string {
+	return folder + "/" + variant + "." + extension
+}
+
+// ProfileImageKeys returns the storage key of every variant by name. Account.ProfileImage holds the
+// key of the original, values set before uploads existed are no keys and give nil.
+func ProfileImageKeys(original string) map[string]string {
+	extension := strings.TrimPrefix(path.Ext(original), ".")
+
+	if !strings.HasPrefix(original, profileImagePrefix) || path.Base(original) != "original."+extension || checkStorageKey(original) != nil {
+		return nil
+	}
+
+	folder := path.Dir(original)
+	keys := make(map[string]string, len(ProfileImageVariants))
+
+	for _, variant := range ProfileImageVariants {
+		keys[variant.Name] = ProfileImageKey(folder, variant.Name, extension)
+	}
+
+	return keys
+}
+
+// ProcessedImage is one encoded variant of an upload.
+type ProcessedImage struct {
+	Variant     string
+	Data        []byte
+	ContentType string
+	Extension   string
+}
+
+// ProcessImage checks the upload and encodes every variant. Images are decoded and encoded again,
+// which drops EXIF and every other piece of metadata, so the JPEG orientation is applied to the
+// pixels first. Images are never scaled up.
+func ProcessImage(data []byte, variants []ImageVariant) ([]ProcessedImage, error) {
+	if len(data) > MaxImageBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	// The content is sniffed, the client's filename and Content-Type are not trusted
+	contentType := http.DetectContentType(data)
+
+	var extension string
+	switch contentType {
+	case "image/jpeg":
+		extension = "jpg"
+	case "image/png":
+		extension = "png"
+	default:
+		return nil, ErrImageType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrImageInvalid
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageDimension
+	}
+
+	imageDecodeSlots <- struct{}{}
+	defer func() { <-imageDecodeSlots }()
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrImageInvalid
+	}
+
+	source := toRGBA(decoded)
+
+	if contentType == "image/jpeg" {
+		source = applyOrientation(source, jpegOrientation(data))
+	}
+
+	processed := make([]ProcessedImage, 0, len(variants))
+
+	for _, variant := range variants {
+		img := source
+
+		if variant.Square {
+			img = cropSquare(img)
+		}
+
+		img = resizeToFit(img, variant.Size)
+
+		var encoded bytes.Buffer
+
+		if contentType == "image/png" {
+			err = png.Encode(&encoded, img)
+		} else {
+			err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		processed = append(processed, ProcessedImage{
+			Variant:     variant.Name,
+			Data:        encoded.Bytes(),
+			ContentType: contentType,
+			Extension:   extension,
+		})
+	}
+
+	return processed, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+func cropSquare(img *image.RGBA) *image.RGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	side := min(width, height)
+	left, top := (width-side)/2, (height-side)/2
+
+	return toRGBA(img.SubImage(image.Rect(left, top, left+side, top+side)))
+}
+
+// resizeToFit scales the image down so its longer side is at most size. Every target pixel is the
+// average of the source pixels it covers, which is good enough for photos scaled down.
+func resizeToFit(img *image.RGBA, size int) *image.RGBA {
+	srcWidth, srcHeight := img.Bounds().Dx(), img.Bounds().Dy()
+
+	if srcWidth <= size && srcHeight <= size {
+		return img
+	}
+
+	width, height := size, size
+	if srcWidth > srcHeight {
+		height = max(1, srcHeight*size/srcWidth)
+	} else if srcHeight > srcWidth {
+		width = max(1, srcWidth*size/srcHeight)
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var r, g, b, a, count int
+
+			for sy := y0; sy < y1; sy++ {
+				row := img.Pix[sy*img.Stride:]
+
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += int(pixel[0])
+					g += int(pixel[1])
+					b += int(pixel[2])
+					a += int(pixel[3])
+					count++
+				}
+			}
+
+			offset := y*resized.Stride + x*4
+			resized.Pix[offset] = uint8(r / count)
+			resized.Pix[offset+1] = uint8(g / count)
+			resized.Pix[offset+2] = uint8(b / count)
+			resized.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return resized
+}
+
+// applyOrientation turns the pixels the way the EXIF orientation says the image is meant to be
+// shown, 1 is upright.
+func applyOrientation(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	destWidth, destHeight := width, height
+	if orientation >= 5 {
+		destWidth, destHeight = height, width
+	}
+
+	oriented := image.NewRGBA(image.Rect(0, 0, destWidth, destHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = width-1-x, y
+			case 3: // upside down
+				dx, dy = width-1-x, height-1-y
+			case 4: // upside down and mirrored
+				dx, dy = x, height-1-y
+			case 5: // mirrored and turned
+				dx, dy = y, x
+			case 6: // turned clockwise
+				dx, dy = height-1-y, x
+			case 7: // mirrored and turned
+				dx, dy = height-1-y, width-1-x
+			case 8: // turned counter clockwise
+				dx, dy = y, width-1-x
+			}
+
+			copy(oriented.Pix[dy*oriented.Stride+dx*4:dy*oriented.Stride+dx*4+4], img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4])
+		}
+	}
+
+	return oriented
+}
+
+// jpegOrientation reads the orientation tag from the EXIF block of a JPEG, 1 when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	offset := 2
+
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+
+		// The image data starts, EXIF always comes before it
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[offset+4 : offset+2+length]
+
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+
+		offset += 2 + length
+	}
+
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
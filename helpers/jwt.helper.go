@@ -1,32 +1,74 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"ecommerce/configs"
+	"encoding/hex"
 	"errors"
-	"fmt"
+	"slices"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token types, every consumer only accepts the type it expects.
+const (
+	TokenTypeAccess        = "access"
+	TokenTypeRefresh       = "refresh"
+	TokenTypeEmailVerify   = "email_verify"
+	TokenTypePasswordReset = "password_reset"
+	TokenTypeTwoFactor     = "two_factor"     // proves the first login step, exchanged for a session with a TOTP code
+	TokenTypeEmailLogin    = "email_login"    // magic login link, single use because its hash is stored as the email OTP
+	TokenTypeSessionRevoke = "session_revoke" // link in the new device alert that signs the new session out
+)
+
+const (
+	defaultTokenIssuer   = "ecommerce-api"
+	defaultTokenAudience = "ecommerce"
+)
+
+var ErrTokenType = errors.New("token has the wrong type")
+
 type TokenClaims struct {
-	UserId string `json:"userId"`
-	Email  string `json:"email"`
-	Mobile string `json:"mobile"`
-	Exp    int64  `json:"exp"`
+	UserId      string   `json:"userId"`
+	Email       string   `json:"email,omitempty"`
+	Mobile      string   `json:"mobile,omitempty"`
+	SessionId   int      `json:"sid,omitempty"` // UserLogin the token belongs to
+	Type        string   `json:"typ,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+	Device      string   `json:"dev,omitempty"` // DeviceBinding of the device a challenge was issued to
+	jwt.RegisteredClaims
 }
 
-func GenerateToken(claims TokenClaims) (string, error) {
+// GenerateToken signs the claims as a token of the given type valid for expiresIn. The registered
+// claims (jti, iat, nbf, exp, iss, aud, sub) are filled in here.
+func GenerateToken(tokenType string, claims TokenClaims, expiresIn time.Duration) (string, error) {
 
-	configs := configs.AppEnv()
+	if jwtKeys == nil {
+		return "", errors.New("jwt keys are not initialized")
+	}
+
+	tokenId, err := randomTokenId()
+	if err != nil {
+		return "", err
+	}
 
-	secret := []byte(configs.JWT_SECRET_KEY)
+	now := time.Now()
+
+	claims.Type = tokenType
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        tokenId,
+		Subject:   claims.UserId,
+		Issuer:    jwtKeys.issuer,
+		Audience:  jwt.ClaimStrings{jwtKeys.audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": claims.UserId,
-		"mobile": claims.Mobile,
-		"email":  claims.Email,
-		"exp":    claims.Exp,
-	}).SignedString(secret)
+	token, err := signToken(claims)
 
 	if err != nil {
 		return "", err
@@ -35,33 +77,76 @@ func GenerateToken(claims TokenClaims) (string, error) {
 	return token, nil
 }
 
-func ParseToken(jwtToken string) (*TokenClaims, error) {
-
-	configs := configs.AppEnv()
+// ParseToken verifies the token and checks that it is of the expected type and was issued by and
+// for this API.
+func ParseToken(jwtToken string, tokenType string) (*TokenClaims, error) {
 
-	secret := []byte(configs.JWT_SECRET_KEY)
+	claims := &TokenClaims{}
 
-	token, err := jwt.Parse(jwtToken, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return secret, nil
-	})
+	token, err := jwt.ParseWithClaims(jwtToken, claims, verificationKey, jwt.WithExpirationRequired(), jwt.WithIssuedAt())
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return &TokenClaims{
-			UserId: claims["userId"].(string),
-			Email:  claims["email"].(string),
-			Mobile: claims["mobile"].(string),
-			Exp:    int64(claims["exp"].(float64)),
-		}, nil
+	// Every token we issue has an id, tokens from before typed tokens have none and are refused
+	if !token.Valid || claims.UserId == "" || claims.ID == "" {
+		return nil, errors.New("invalid token")
+	}
+
+	if claims.Type != tokenType {
+		return nil, ErrTokenType
+	}
+
+	if claims.Issuer != jwtKeys.issuer {
+		return nil, jwt.ErrTokenInvalidIssuer
+	}
+
+	if !slices.Contains(claims.Audience, jwtKeys.audience) {
+		return nil, jwt.ErrTokenInvalidAudience
 	}
 
-	return nil, errors.New("invalid token")
+	return claims, nil
+
+}
+
+// HashToken returns the hex SHA-256 of a token, only this hash is stored for refresh tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenIssuer(env configs.EnvConfig) string {
+	if env.JWT_ISSUER != "" {
+		return env.JWT_ISSUER
+	}
+	return defaultTokenIssuer
+}
+
+func tokenAudience(env configs.EnvConfig) string {
+	if env.JWT_AUDIENCE != "" {
+		return env.JWT_AUDIENCE
+	}
+	return defaultTokenAudience
+}
+
+func randomTokenId() (string, error) {
+	id := make([]byte, 16)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// IsTokenExpired reports whether ParseToken rejected a token only because it expired.
+func IsTokenExpired(err error) bool {
+	return errors.Is(err, jwt.ErrTokenExpired)
+}
 
+// DeviceBinding identifies the device a login step came from, so a challenge token only completes
+// the login on that device.
+func DeviceBinding(fcm string, platform string) string {
+	return HashToken(fcm + "\x00" + platform)
 }
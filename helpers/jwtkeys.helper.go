@@ -0,0 +1,269 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"ecommerce/configs"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTKey is a key loaded from the key directory. Keys without a private half can only verify,
+// which is how retired keys are kept around until the tokens they signed have expired.
+type JWTKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+type jwtKeySet struct {
+	signing  *JWTKey
+	keys     map[string]*JWTKey
+	secret   []byte    // HS256 secret, used when no key directory is configured
+	legacyTo time.Time // with a key directory, HS256 tokens are still accepted until then
+	issuer   string
+	audience string
+}
+
+var jwtKeys *jwtKeySet
+
+// InitJWTKeys loads the signing keys once on startup. Every <kid>.pem file in JWT_KEYS_DIR is a key,
+// JWT_SIGNING_KEY_ID picks the one new tokens are signed with (the last one by name otherwise).
+// Without a key directory tokens are signed with JWT_SECRET_KEY. With one, JWT_SECRET_KEY is ignored
+// unless JWT_ACCEPT_LEGACY_HS256 names the time until which tokens signed with it stay valid.
+func InitJWTKeys(env configs.EnvConfig) error {
+	keySet := &jwtKeySet{
+		keys:     map[string]*JWTKey{},
+		issuer:   tokenIssuer(env),
+		audience: tokenAudience(env),
+	}
+
+	if env.JWT_KEYS_DIR == "" {
+		if env.JWT_SECRET_KEY == "" {
+			return errors.New("either JWT_KEYS_DIR or JWT_SECRET_KEY has to be set")
+		}
+		keySet.secret = []byte(env.JWT_SECRET_KEY)
+		jwtKeys = keySet
+		return nil
+	}
+
+	if env.JWT_ACCEPT_LEGACY_HS256 != "" {
+		cutoff, err := time.Parse(time.RFC3339, env.JWT_ACCEPT_LEGACY_HS256)
+		if err != nil {
+			return fmt.Errorf("invalid JWT_ACCEPT_LEGACY_HS256, expected an RFC 3339 time: %w", err)
+		}
+		if env.JWT_SECRET_KEY == "" {
+			return errors.New("JWT_ACCEPT_LEGACY_HS256 needs JWT_SECRET_KEY")
+		}
+
+		// The switch to key files is pointless while the secret keeps working, so it only does until the cutoff
+		if time.Now().Before(cutoff) {
+			keySet.secret = []byte(env.JWT_SECRET_KEY)
+			keySet.legacyTo = cutoff
+			log.Printf("Accepting HS256 tokens until %s", cutoff.Format(time.RFC3339))
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(env.JWT_KEYS_DIR, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(files)
+
+	var lastSigner *JWTKey
+
+	for _, file := range files {
+		key, err := loadJWTKey(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		keySet.keys[key.ID] = key
+
+		if key.Private != nil {
+			lastSigner = key
+		}
+	}
+
+	if env.JWT_SIGNING_KEY_ID != "" {
+		key, ok := keySet.keys[env.JWT_SIGNING_KEY_ID]
+		if !ok || key.Private == nil {
+			return fmt.Errorf("no private key found for JWT_SIGNING_KEY_ID %s", env.JWT_SIGNING_KEY_ID)
+		}
+		keySet.signing = key
+	} else {
+		keySet.signing = lastSigner
+	}
+
+	if keySet.signing == nil {
+		return fmt.Errorf("no private key found in %s", env.JWT_KEYS_DIR)
+	}
+
+	log.Printf("Loaded %d JWT keys, signing with %s", len(keySet.keys), keySet.signing.ID)
+
+	jwtKeys = keySet
+
+	return nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set. HS256 secrets are never published.
+func JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+
+	if jwtKeys == nil {
+		return map[string]interface{}{"keys": keys}
+	}
+
+	ids := make([]string, 0, len(jwtKeys.keys))
+	for id := range jwtKeys.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := jwtKeys.keys[id]
+
+		jwk := map[string]string{
+			"kid": key.ID,
+			"alg": key.Method.Alg(),
+			"use": "sig",
+		}
+
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk["kty"] = "EC"
+			jwk["crv"] = public.Curve.Params().Name
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size)))
+			jwk["y"] = base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size)))
+		}
+
+		keys = append(keys, jwk)
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
+
+func signToken(claims jwt.Claims) (string, error) {
+	if jwtKeys == nil {
+		return "", errors.New("jwt keys are not initialized")
+	}
+
+	if jwtKeys.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKeys.secret)
+	}
+
+	token := jwt.NewWithClaims(jwtKeys.signing.Method, claims)
+	token.Header["kid"] = jwtKeys.signing.ID
+
+	return token.SignedString(jwtKeys.signing.Private)
+}
+
+// verificationKey picks the key for a token by its kid, tokens without one were signed with the secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if jwtKeys == nil {
+		return nil, errors.New("jwt keys are not initialized")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	if kid == "" {
+		// Validate the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || jwtKeys.secret == nil {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if !jwtKeys.legacyTo.IsZero() && !time.Now().Before(jwtKeys.legacyTo) {
+			return nil, errors.New("HS256 tokens are no longer accepted")
+		}
+		return jwtKeys.secret, nil
+	}
+
+	key, ok := jwtKeys.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+func loadJWTKey(file string) (*JWTKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &JWTKey{ID: strings.TrimSuffix(filepath.Base(file), ".pem")}
+
+	var parsed interface{}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.Private = signer
+		key.Public = signer.Public()
+	} else {
+		key.Public = parsed
+	}
+
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch public.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		default:
+			return nil, errors.New("only P-256 and P-384 EC keys are supported")
+		}
+	default:
+		return nil, errors.New("only RSA and EC keys are supported")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,321 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"ecommerce/configs"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	OAuthProviderGoogle = "google"
+	OAuthProviderApple  = "apple"
+)
+
+const (
+	defaultGoogleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+	defaultAppleJWKSURL  = "https://appleid.apple.com/auth/keys"
+	jwksCacheTTL         = time.Hour
+	jwksMinRefresh       = time.Minute
+)
+
+var ErrUnknownKey = errors.New("unknown key id")
+
+// ExternalIdentity is what we learn about a user from a verified provider ID token.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	IssuedAt      time.Time
+}
+
+// IDTokenVerifier checks an ID token issued by a sign-in provider.
+type IDTokenVerifier interface {
+	Verify(idToken string) (*ExternalIdentity, error)
+}
+
+// KeySource looks up a provider's public key by kid.
+type KeySource interface {
+	Key(kid string) (interface{}, error)
+}
+
+var (
+	oauthVerifiersMu sync.RWMutex
+	oauthVerifiers   = map[string]IDTokenVerifier{}
+)
+
+// InitOAuthVerifiers sets up a verifier for every provider that has client ids configured.
+func InitOAuthVerifiers(env configs.EnvConfig) {
+	if clientIds := splitList(env.GOOGLE_CLIENT_IDS); len(clientIds) > 0 {
+		SetOAuthVerifier(OAuthProviderGoogle, &JWKSVerifier{
+			Provider:  OAuthProviderGoogle,
+			Issuers:   []string{"accounts.google.com", "https://accounts.google.com"},
+			Audiences: clientIds,
+			Keys:      NewRemoteJWKS(valueOr(env.GOOGLE_JWKS_URL, defaultGoogleJWKSURL)),
+		})
+	}
+
+	if clientIds := splitList(env.APPLE_CLIENT_IDS); len(clientIds) > 0 {
+		SetOAuthVerifier(OAuthProviderApple, &JWKSVerifier{
+			Provider:  OAuthProviderApple,
+			Issuers:   []string{"https://appleid.apple.com"},
+			Audiences: clientIds,
+			Keys:      NewRemoteJWKS(valueOr(env.APPLE_JWKS_URL, defaultAppleJWKSURL)),
+		})
+	}
+}
+
+// SetOAuthVerifier installs the verifier for a provider, tests use it with a StaticJWKS.
+func SetOAuthVerifier(provider string, verifier IDTokenVerifier) {
+	oauthVerifiersMu.Lock()
+	defer oauthVerifiersMu.Unlock()
+
+	oauthVerifiers[provider] = verifier
+}
+
+// GetOAuthVerifier returns nil when the provider is not enabled.
+func GetOAuthVerifier(provider string) IDTokenVerifier {
+	oauthVerifiersMu.RLock()
+	defer oauthVerifiersMu.RUnlock()
+
+	return oauthVerifiers[provider]
+}
+
+// JWKSVerifier verifies ID tokens signed with keys from a JWKS.
+type JWKSVerifier struct {
+	Provider  string
+	Issuers   []string
+	Audiences []string // our client ids
+	Keys      KeySource
+}
+
+type providerClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"` // Apple sends "true" as a string
+	Name          string      `json:"name"`
+	jwt.RegisteredClaims
+}
+
+func (v *JWKSVerifier) Verify(idToken string) (*ExternalIdentity, error) {
+	claims := &providerClaims{}
+
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.Keys.Key(kid)
+	}, jwt.WithValidMethods([]string{"RS256", "ES256"}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(v.Issuers, claims.Issuer) {
+		return nil, jwt.ErrTokenInvalidIssuer
+	}
+
+	if !slices.ContainsFunc(claims.Audience, func(audience string) bool { return slices.Contains(v.Audiences, audience) }) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	emailVerified := false
+
+	switch value := claims.EmailVerified.(type) {
+	case bool:
+		emailVerified = value
+	case string:
+		emailVerified = value == "true"
+	}
+
+	var issuedAt time.Time
+
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	return &ExternalIdentity{
+		Provider:      v.Provider,
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: emailVerified,
+		Name:          claims.Name,
+		IssuedAt:      issuedAt,
+	}, nil
+}
+
+// RemoteJWKS fetches a provider's keys and caches them. An unknown kid triggers a refetch, at most
+// once a minute, so provider key rotation is picked up without a restart.
+type RemoteJWKS struct {
+	URL    string
+	Client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func NewRemoteJWKS(url string) *RemoteJWKS {
+	return &RemoteJWKS{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (r *RemoteJWKS) Key(kid string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.keys[kid]; ok && time.Since(r.fetchedAt) < jwksCacheTTL {
+		return key, nil
+	}
+
+	if time.Since(r.fetchedAt) >= jwksMinRefresh {
+		if err := r.fetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := r.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (r *RemoteJWKS) fetch() error {
+	response, err := r.Client.Get(r.URL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", r.URL, response.Status)
+	}
+
+	var document jwksDocument
+	if err := json.NewDecoder(response.Body).Decode(&document); err != nil {
+		return err
+	}
+
+	keys, err := document.publicKeys()
+	if err != nil {
+		return err
+	}
+
+	r.keys = keys
+	r.fetchedAt = time.Now()
+
+	return nil
+}
+
+// StaticJWKS is a fixed key set, for tests and for providers whose keys are pinned in config.
+type StaticJWKS struct {
+	keys map[string]interface{}
+}
+
+// NewStaticJWKS parses a JWKS document such as the one served by /.well-known/jwks.json.
+func NewStaticJWKS(data []byte) (*StaticJWKS, error) {
+	var document jwksDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keys, err := document.publicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return &StaticJWKS{keys: keys}, nil
+}
+
+func (s *StaticJWKS) Key(kid string) (interface{}, error) {
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+type jwksDocument struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	} `json:"keys"`
+}
+
+func (d jwksDocument) publicKeys() (map[string]interface{}, error) {
+	keys := map[string]interface{}{}
+
+	for _, jwk := range d.Keys {
+		switch jwk.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				return nil, err
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if err != nil {
+				return nil, err
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	return keys, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// Optional is a field of a JSON Merge Patch (RFC 7396) payload. It tells a field that was left out
+// (Set is false) from one sent as null (Null is true) and from one sent with its zero value.
+type Optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	var zero T
+
+	o.Set = true
+	o.Null = string(data) == "null"
+	o.Value = zero
+
+	if o.Null {
+		return nil
+	}
+
+	return json.Unmarshal(data, &o.Value)
+}
+
+// Present reports whether the field was sent with a value.
+func (o Optional[T]) Present() bool {
+	return o.Set && !o.Null
+}
+
+// Cleared reports whether the field was sent as null or with its zero value.
+func (o Optional[T]) Cleared() bool {
+	return o.Set && (o.Null || reflect.ValueOf(&o.Value).Elem().IsZero())
+}
+
+// validationValue is what the validate tags of the field are checked against, nothing when the field
+// has no value so omitempty skips it.
+func (o Optional[T]) validationValue() interface{} {
+	if !o.Present() {
+		return nil
+	}
+	return o.Value
+}
+
+type optionalField interface {
+	validationValue() interface{}
+}
+
+// optionalTypes are the Optional fields payloads use, the validator needs every one of them.
+var optionalTypes = []interface{}{Optional[string]{}, Optional[bool]{}, Optional[int]{}, Optional[float64]{}}
+
+func optionalValue(field reflect.Value) interface{} {
+	if optional, ok := field.Interface().(optionalField); ok {
+		return optional.validationValue()
+	}
+	return nil
+}
+
+// Required reports the fields that were cleared although they can't be removed, in the shape of the
+// ValidateStruct errors.
+func Required(fields map[string]bool) []*ErrorResponse {
+	var errors []*ErrorResponse
+
+	for field, cleared := range fields {
+		if cleared {
+			errors = append(errors, &ErrorResponse{Field: field, Tag: "required"})
+		}
+	}
+
+	sort.Slice(errors, func(i, j int) bool { return errors[i].Field < errors[j].Field })
+
+	return errors
+}
@@ -1,12 +1,256 @@
 package helpers
 
-import "fmt"
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"ecommerce/configs"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
-func GenerateOtp() string {
-	return "123456"
+const (
+	defaultOtpLength = 6
+	minOtpLength     = 4
+	maxOtpLength     = 10
+	otpHashVersion   = "v1"
+	otpSaltLength    = 16
+)
+
+// OTPSender delivers a one time password to a mobile number.
+// Every SMS provider we plug in has to implement this.
+type OTPSender interface {
+	SendOTP(otp string, mobile string) error
+}
+
+// OTPMessage is a single message handed to the local driver.
+type OTPMessage struct {
+	Mobile string    `json:"mobile"`
+	Otp    string    `json:"otp"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+var (
+	otpSender  OTPSender = NewMemoryOTPSender()
+	otpLength            = defaultOtpLength
+	otpHashKey []byte
+)
+
+// InitOTPSender selects the OTP driver and code length from the env config.
+// It is called once on startup.
+func InitOTPSender(env configs.EnvConfig) error {
+	length := defaultOtpLength
+
+	if env.OTP_LENGTH != "" {
+		parsed, err := strconv.Atoi(env.OTP_LENGTH)
+		if err != nil || parsed < minOtpLength || parsed > maxOtpLength {
+			return fmt.Errorf("OTP_LENGTH must be a number between %d and %d", minOtpLength, maxOtpLength)
+		}
+		length = parsed
+	}
+
+	var sender OTPSender
+
+	switch env.OTP_DRIVER {
+	case "", "local":
+		// Without a spool file the messages are only kept in memory
+		if env.OTP_SPOOL_FILE == "" {
+			sender = NewMemoryOTPSender()
+		} else {
+			sender = NewFileOTPSender(env.OTP_SPOOL_FILE)
+		}
+	case "memory":
+		sender = NewMemoryOTPSender()
+	default:
+		return fmt.Errorf("unknown OTP_DRIVER: %s", env.OTP_DRIVER)
+	}
+
+	// There is no SMS driver yet, the local ones never reach a phone and nobody could log in
+	if env.GO_ENV == "production" {
+		return errors.New("no OTP_DRIVER can deliver SMS in production")
+	}
+
+	// Codes are hashed with a dedicated secret, sharing one with the tokens would tie their rotation
+	secret := env.OTP_HASH_SECRET
+	if secret == "" {
+		return errors.New("OTP_HASH_SECRET is not set")
+	}
+
+	otpLength = length
+	otpSender = sender
+	otpHashKey = []byte(secret)
+
+	return nil
+}
+
+// SetOTPSender replaces the active driver, tests use it to install a memory outbox.
+func SetOTPSender(sender OTPSender) {
+	otpSender = sender
+}
+
+// GetOTPSender returns the active driver.
+func GetOTPSender() OTPSender {
+	return otpSender
+}
+
+// GenerateOtp returns a numeric code of the configured length read from crypto/rand.
+func GenerateOtp() (string, error) {
+	max := big.NewInt(10)
+
+	otp := make([]byte, otpLength)
+
+	for i := range otp {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		otp[i] = byte('0' + n.Int64())
+	}
+
+	return string(otp), nil
+}
+
+// HashOtp returns a salted HMAC of the code in the form v1$<salt>$<mac>.
+func HashOtp(otp string) (string, error) {
+	salt := make([]byte, otpSaltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	encodedSalt := hex.EncodeToString(salt)
+
+	return otpHashVersion + "$" + encodedSalt + "$" + otpMac(encodedSalt, otp), nil
+}
+
+// CompareOtp reports whether the code matches a hash made by HashOtp. The comparison
+// takes the same time whether or not the code matches.
+func CompareOtp(hash string, otp string) bool {
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 3 || parts[0] != otpHashVersion {
+		return false
+	}
+
+	return hmac.Equal([]byte(parts[2]), []byte(otpMac(parts[1], otp)))
+}
+
+// IsHashedOtp reports whether the stored value was made by HashOtp.
+func IsHashedOtp(value string) bool {
+	return strings.HasPrefix(value, otpHashVersion+"$")
+}
+
+func otpMac(salt string, otp string) string {
+	mac := hmac.New(sha256.New, otpHashKey)
+	mac.Write([]byte(salt))
+	mac.Write([]byte(otp))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 func SendOTP(otp string, mobile string) error {
-	fmt.Println("OTP: ", otp, "Mobile: ", mobile)
+	if otpSender == nil {
+		return errors.New("otp sender is not initialized")
+	}
+	return otpSender.SendOTP(otp, mobile)
+}
+
+func otpMessage(otp string, mobile string) OTPMessage {
+	return OTPMessage{
+		Mobile: mobile,
+		Otp:    otp,
+		Text:   fmt.Sprintf("%s is your verification code. Do not share it with anyone.", otp),
+		SentAt: time.Now(),
+	}
+}
+
+// MemoryOTPSender keeps every message in memory so tests can read the code back.
+type MemoryOTPSender struct {
+	mu       sync.Mutex
+	messages []OTPMessage
+}
+
+func NewMemoryOTPSender() *MemoryOTPSender {
+	return &MemoryOTPSender{}
+}
+
+func (m *MemoryOTPSender) SendOTP(otp string, mobile string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, otpMessage(otp, mobile))
 	return nil
 }
+
+// Messages returns a copy of the outbox.
+func (m *MemoryOTPSender) Messages() []OTPMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]OTPMessage, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+// LastOTP returns the most recent code sent to the mobile number.
+func (m *MemoryOTPSender) LastOTP(mobile string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].Mobile == mobile {
+			return m.messages[i].Otp, true
+		}
+	}
+	return "", false
+}
+
+// Reset empties the outbox.
+func (m *MemoryOTPSender) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
+
+// FileOTPSender appends every message as a JSON line to a spool file.
+type FileOTPSender struct {
+	mu   sync.Mutex
+	Path string
+}
+
+func NewFileOTPSender(path string) *FileOTPSender {
+	return &FileOTPSender{Path: path}
+}
+
+func (f *FileOTPSender) SendOTP(otp string, mobile string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line, err := json.Marshal(otpMessage(otp, mobile))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
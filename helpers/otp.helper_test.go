@@ -0,0 +1,301 @@
+package helpers
+
+import (
+	"bufio"
+	"ecommerce/configs"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// keepOTPSettings restores the package state InitOTPSender changes.
+func keepOTPSettings(t *testing.T) {
+	t.Helper()
+
+	sender, length, key := otpSender, otpLength, otpHashKey
+
+	t.Cleanup(func() {
+		otpSender, otpLength, otpHashKey = sender, length, key
+	})
+}
+
+func TestInitOTPSender(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "otp.spool")
+
+	tests := []struct {
+		name    string
+		env     configs.EnvConfig
+		wantErr bool
+		check   func(t *testing.T)
+	}{
+		{
+			name: "defaults to memory",
+			env:  configs.EnvConfig{OTP_HASH_SECRET: "secret"},
+			check: func(t *testing.T) {
+				if _, ok := GetOTPSender().(*MemoryOTPSender); !ok {
+					t.Errorf("sender = %T, want *MemoryOTPSender", GetOTPSender())
+				}
+				if otpLength != defaultOtpLength {
+					t.Errorf("otpLength = %d, want %d", otpLength, defaultOtpLength)
+				}
+			},
+		},
+		{
+			name: "local with spool file",
+			env:  configs.EnvConfig{OTP_DRIVER: "local", OTP_SPOOL_FILE: spool, OTP_HASH_SECRET: "secret"},
+			check: func(t *testing.T) {
+				if _, ok := GetOTPSender().(*FileOTPSender); !ok {
+					t.Errorf("sender = %T, want *FileOTPSender", GetOTPSender())
+				}
+			},
+		},
+		{
+			name: "custom length",
+			env:  configs.EnvConfig{OTP_LENGTH: "8", OTP_HASH_SECRET: "secret"},
+			check: func(t *testing.T) {
+				if otpLength != 8 {
+					t.Errorf("otpLength = %d, want 8", otpLength)
+				}
+			},
+		},
+		{name: "length too short", env: configs.EnvConfig{OTP_LENGTH: "3", OTP_HASH_SECRET: "secret"}, wantErr: true},
+		{name: "length too long", env: configs.EnvConfig{OTP_LENGTH: "11", OTP_HASH_SECRET: "secret"}, wantErr: true},
+		{name: "length not a number", env: configs.EnvConfig{OTP_LENGTH: "six", OTP_HASH_SECRET: "secret"}, wantErr: true},
+		{name: "unknown driver", env: configs.EnvConfig{OTP_DRIVER: "carrier-pigeon", OTP_HASH_SECRET: "secret"}, wantErr: true},
+		{name: "missing hash secret", env: configs.EnvConfig{}, wantErr: true},
+		{name: "local driver in production", env: configs.EnvConfig{GO_ENV: "production", OTP_HASH_SECRET: "secret"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keepOTPSettings(t)
+
+			err := InitOTPSender(test.env)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("InitOTPSender succeeded, want an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("InitOTPSender: %v", err)
+			}
+
+			test.check(t)
+		})
+	}
+}
+
+func TestGenerateOtp(t *testing.T) {
+	keepOTPSettings(t)
+
+	for _, length := range []int{minOtpLength, defaultOtpLength, maxOtpLength} {
+		otpLength = length
+		seen := map[string]bool{}
+
+		for i := 0; i < 50; i++ {
+			otp, err := GenerateOtp()
+			if err != nil {
+				t.Fatalf("GenerateOtp: %v", err)
+			}
+
+			if len(otp) != length || !isDigits(otp) {
+				t.Fatalf("GenerateOtp() = %q, want %d digits", otp, length)
+			}
+
+			seen[otp] = true
+		}
+
+		// 50 draws from at least 10^4 codes practically never repeat much
+		if len(seen) < 40 {
+			t.Errorf("only %d distinct codes out of 50 with length %d", len(seen), length)
+		}
+	}
+}
+
+func TestMemoryOTPSender(t *testing.T) {
+	sender := NewMemoryOTPSender()
+
+	if err := sender.SendOTP("111111", "+919876543210"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendOTP("222222", "+447911123456"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendOTP("333333", "+919876543210"); err != nil {
+		t.Fatal(err)
+	}
+
+	if otp, ok := sender.LastOTP("+919876543210"); !ok || otp != "333333" {
+		t.Errorf("LastOTP = %q, %v, want 333333", otp, ok)
+	}
+
+	if _, ok := sender.LastOTP("+15555550100"); ok {
+		t.Error("LastOTP found a code for a number nothing was sent to")
+	}
+
+	messages := sender.Messages()
+
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	if !strings.Contains(messages[1].Text, "222222") || messages[1].Mobile != "+447911123456" {
+		t.Errorf("unexpected message %+v", messages[1])
+	}
+
+	// The outbox is a copy
+	messages[0].Otp = "changed"
+	if sender.Messages()[0].Otp != "111111" {
+		t.Error("Messages returned the outbox itself")
+	}
+
+	sender.Reset()
+
+	if len(sender.Messages()) != 0 {
+		t.Error("Reset left messages behind")
+	}
+}
+
+func TestFileOTPSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool", "otp.spool")
+	sender := NewFileOTPSender(path)
+
+	for _, otp := range []string{"123456", "654321"} {
+		if err := sender.SendOTP(otp, "+919876543210"); err != nil {
+			t.Fatalf("SendOTP: %v", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var messages []OTPMessage
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var message OTPMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("spool line %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, message)
+	}
+
+	if len(messages) != 2 || messages[0].Otp != "123456" || messages[1].Otp != "654321" {
+		t.Fatalf("spool holds %+v", messages)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("spool file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestSendOTPUsesActiveSender(t *testing.T) {
+	keepOTPSettings(t)
+
+	sender := NewMemoryOTPSender()
+	SetOTPSender(sender)
+
+	if err := SendOTP("987654", "+919876543210"); err != nil {
+		t.Fatal(err)
+	}
+
+	if otp, ok := sender.LastOTP("+919876543210"); !ok || otp != "987654" {
+		t.Errorf("LastOTP = %q, %v, want 987654", otp, ok)
+	}
+}
+
+func TestHashOtp(t *testing.T) {
+	keepOTPSettings(t)
+	otpHashKey = []byte("test-secret")
+
+	hash, err := HashOtp("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 || parts[0] != otpHashVersion || len(parts[1]) != otpSaltLength*2 {
+		t.Fatalf("HashOtp() = %q, want v1$<salt>$<mac>", hash)
+	}
+
+	if strings.Contains(hash, "123456") {
+		t.Error("the hash contains the code")
+	}
+
+	if !IsHashedOtp(hash) {
+		t.Error("IsHashedOtp does not recognize the hash")
+	}
+
+	// Every hash gets its own salt
+	other, err := HashOtp("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("two hashes of the same code are equal")
+	}
+}
+
+func TestCompareOtp(t *testing.T) {
+	keepOTPSettings(t)
+	otpHashKey = []byte("test-secret")
+
+	hash, err := HashOtp("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !CompareOtp(hash, "123456") {
+		t.Error("the right code does not match")
+	}
+
+	for _, otp := range []string{"123457", "12345", "1234567", ""} {
+		if CompareOtp(hash, otp) {
+			t.Errorf("%q matches the hash of 123456", otp)
+		}
+	}
+
+	// Rotating the secret invalidates the stored hashes
+	otpHashKey = []byte("another-secret")
+	if CompareOtp(hash, "123456") {
+		t.Error("the code matches under a different secret")
+	}
+}
+
+func TestCompareOtpRejectsMalformedHashes(t *testing.T) {
+	keepOTPSettings(t)
+	otpHashKey = []byte("test-secret")
+
+	hash, err := HashOtp("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hash, "$")
+
+	for _, stored := range []string{
+		"123456", // a plaintext code left from before hashing
+		"",
+		"v1$" + parts[1],
+		"v2$" + parts[1] + "$" + parts[2],
+		hash + "$extra",
+	} {
+		if CompareOtp(stored, "123456") {
+			t.Errorf("CompareOtp(%q) matched", stored)
+		}
+	}
+
+	if IsHashedOtp("123456") {
+		t.Error("IsHashedOtp takes a plaintext code for a hash")
+	}
+}
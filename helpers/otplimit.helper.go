@@ -0,0 +1,405 @@
+package helpers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/models"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// OTPLimits controls how often an OTP can be sent and guessed.
+type OTPLimits struct {
+	MaxAttempts     int           // wrong guesses before the account is locked
+	MaxSends        int           // codes sent within one send window
+	SendWindow      time.Duration // window for MaxSends
+	ResendCooldown  time.Duration // minimum gap between two codes
+	LockoutDuration time.Duration // how long a lock lasts
+}
+
+var otpLimits = OTPLimits{
+	MaxAttempts:     5,
+	MaxSends:        5,
+	SendWindow:      time.Hour,
+	ResendCooldown:  time.Minute,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// OTPLimitError is returned when a request has to wait before it can be retried.
+type OTPLimitError struct {
+	Reason     string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *OTPLimitError) Error() string {
+	return e.Message
+}
+
+const (
+	OTPLimitLocked   = "locked"
+	OTPLimitCooldown = "cooldown"
+	OTPLimitSends    = "too_many_sends"
+)
+
+// InitOTPLimits reads the OTP limits from the env config, unset values keep their defaults.
+func InitOTPLimits(env configs.EnvConfig) error {
+	limits := otpLimits
+
+	if err := parseIntEnv("OTP_MAX_ATTEMPTS", env.OTP_MAX_ATTEMPTS, &limits.MaxAttempts); err != nil {
+		return err
+	}
+	if err := parseIntEnv("OTP_MAX_SENDS", env.OTP_MAX_SENDS, &limits.MaxSends); err != nil {
+		return err
+	}
+	if err := parseDurationEnv("OTP_SEND_WINDOW", env.OTP_SEND_WINDOW, &limits.SendWindow); err != nil {
+		return err
+	}
+	if err := parseDurationEnv("OTP_COOLDOWN", env.OTP_COOLDOWN, &limits.ResendCooldown); err != nil {
+		return err
+	}
+	if err := parseDurationEnv("OTP_LOCKOUT", env.OTP_LOCKOUT, &limits.LockoutDuration); err != nil {
+		return err
+	}
+
+	otpLimits = limits
+
+	return nil
+}
+
+// GetOTPLimits returns the active limits.
+func GetOTPLimits() OTPLimits {
+	return otpLimits
+}
+
+// CheckOTPSend returns an *OTPLimitError when a new code may not be sent for this row yet.
+func CheckOTPSend(throttle *models.OtpThrottle, now time.Time) error {
+	if now.Before(throttle.LockedUntil) {
+		return lockedError(throttle.LockedUntil.Sub(now))
+	}
+
+	if !throttle.LastSentAt.IsZero() && now.Before(throttle.LastSentAt.Add(otpLimits.ResendCooldown)) {
+		return &OTPLimitError{
+			Reason:     OTPLimitCooldown,
+			Message:    "Please wait before requesting another OTP!",
+			RetryAfter: throttle.LastSentAt.Add(otpLimits.ResendCooldown).Sub(now),
+		}
+	}
+
+	windowEnd := throttle.SendWindowAt.Add(otpLimits.SendWindow)
+
+	if now.Before(windowEnd) && throttle.SendCount >= otpLimits.MaxSends {
+		return &OTPLimitError{
+			Reason:     OTPLimitSends,
+			Message:    "Too many OTP requests. Please try again later!",
+			RetryAfter: windowEnd.Sub(now),
+		}
+	}
+
+	return nil
+}
+
+// RecordOTPSend updates the send counters after a new code was issued. Failed attempts
+// belong to the previous code so they start over.
+func RecordOTPSend(throttle *models.OtpThrottle, now time.Time) {
+	if !now.Before(throttle.SendWindowAt.Add(otpLimits.SendWindow)) {
+		throttle.SendWindowAt = now
+		throttle.SendCount = 0
+	}
+
+	throttle.SendCount++
+	throttle.LastSentAt = now
+	throttle.Attempts = 0
+}
+
+// CheckOTPVerify returns an *OTPLimitError while the row is locked.
+func CheckOTPVerify(throttle *models.OtpThrottle, now time.Time) error {
+	if now.Before(throttle.LockedUntil) {
+		return lockedError(throttle.LockedUntil.Sub(now))
+	}
+	return nil
+}
+
+// RecordOTPFailure counts a wrong guess and locks the row once MaxAttempts is reached. The
+// caller burns the current code when it returns the lock, so a new one has to be requested
+// afterwards.
+func RecordOTPFailure(throttle *models.OtpThrottle, now time.Time) error {
+	throttle.Attempts++
+
+	if throttle.Attempts < otpLimits.MaxAttempts {
+		return nil
+	}
+
+	throttle.Attempts = 0
+	throttle.LockedUntil = now.Add(otpLimits.LockoutDuration)
+
+	return lockedError(otpLimits.LockoutDuration)
+}
+
+// CheckMobileOTPSend returns an *OTPLimitError when no more codes may go to the mobile number.
+// The limit is per number regardless of the account, so it also holds for numbers that are
+// registered again.
+func CheckMobileOTPSend(mobile string) error {
+	return checkRecipientSend("otp:send:"+mobile, "otp:fail:"+mobile)
+}
+
+// RecordMobileOTPSend counts a code sent to the mobile number, once it was issued.
+func RecordMobileOTPSend(mobile string) {
+	incrementCounter("otp:send:"+mobile, otpLimits.SendWindow)
+}
+
+// CheckMobileOTPVerify returns an *OTPLimitError while the mobile number is locked.
+func CheckMobileOTPVerify(mobile string) error {
+	return checkMobileLock(mobile)
+}
+
+// RecordMobileOTPFailure counts a wrong guess against the mobile number.
+func RecordMobileOTPFailure(mobile string) error {
+	return recordFailure("otp:fail:" + mobile)
+}
+
+// ResetMobileOTPFailures forgets the wrong guesses once a code for the number was right.
+func ResetMobileOTPFailures(mobile string) {
+	resetCounter("otp:fail:" + mobile)
+}
+
+// CheckEmailOTPSend returns an *OTPLimitError when no more login codes or links may go to the
+// email address.
+func CheckEmailOTPSend(email string) error {
+	return checkRecipientSend("otp:send:email:"+email, "otp:fail:email:"+email)
+}
+
+// RecordEmailOTPSend counts a code or link sent to the email address, once it was issued.
+func RecordEmailOTPSend(email string) {
+	incrementCounter("otp:send:email:"+email, otpLimits.SendWindow)
+}
+
+// CheckEmailOTPVerify returns an *OTPLimitError while the email address is locked.
+func CheckEmailOTPVerify(email string) error {
+	return checkFailureLock("otp:fail:email:" + email)
+}
+
+// RecordEmailOTPFailure counts a wrong guess against the email address.
+func RecordEmailOTPFailure(email string) error {
+	return recordFailure("otp:fail:email:" + email)
+}
+
+// ResetEmailOTPFailures forgets the wrong guesses once a code for the address was right.
+func ResetEmailOTPFailures(email string) {
+	resetCounter("otp:fail:email:" + email)
+}
+
+// CheckPasswordLogin returns an *OTPLimitError while password logins to the account are locked.
+// Passwords share the OTP attempt limits.
+func CheckPasswordLogin(accountId string) error {
+	return checkFailureLock("password:fail:" + accountId)
+}
+
+// RecordPasswordFailure counts a wrong password against the account.
+func RecordPasswordFailure(accountId string) error {
+	return recordFailure("password:fail:" + accountId)
+}
+
+// CheckTwoFactorLogin returns an *OTPLimitError while second step codes for the account are locked.
+func CheckTwoFactorLogin(accountId string) error {
+	return checkFailureLock("2fa:fail:" + accountId)
+}
+
+// RecordTwoFactorFailure counts a wrong TOTP or recovery code against the account.
+func RecordTwoFactorFailure(accountId string) error {
+	return recordFailure("2fa:fail:" + accountId)
+}
+
+func checkMobileLock(mobile string) error {
+	return checkFailureLock("otp:fail:" + mobile)
+}
+
+func checkRecipientSend(sendKey string, failKey string) error {
+	if err := checkFailureLock(failKey); err != nil {
+		return err
+	}
+
+	count, ok := readCounter(sendKey)
+
+	if ok && count >= otpLimits.MaxSends {
+		return &OTPLimitError{
+			Reason:     OTPLimitSends,
+			Message:    "Too many OTP requests. Please try again later!",
+			RetryAfter: counterRemaining(sendKey, otpLimits.SendWindow),
+		}
+	}
+
+	return nil
+}
+
+func recordFailure(key string) error {
+	count, ok := incrementCounter(key, otpLimits.LockoutDuration)
+
+	if ok && count >= uint64(otpLimits.MaxAttempts) {
+		return lockedError(counterRemaining(key, otpLimits.LockoutDuration))
+	}
+
+	return nil
+}
+
+func checkFailureLock(key string) error {
+	count, ok := readCounter(key)
+
+	if ok && count >= otpLimits.MaxAttempts {
+		return lockedError(counterRemaining(key, otpLimits.LockoutDuration))
+	}
+
+	return nil
+}
+
+// OTPCounterStore keeps the per recipient counters. It is memcache unless a test installs another one.
+type OTPCounterStore interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, expiration time.Duration) error
+	Increment(key string, delta uint64, expiration time.Duration) (uint64, error)
+	Delete(key string) error
+}
+
+var otpCounters OTPCounterStore
+
+// SetOTPCounterStore replaces the counter store, nil goes back to memcache.
+func SetOTPCounterStore(store OTPCounterStore) {
+	otpCounters = store
+}
+
+func counterStore() OTPCounterStore {
+	if otpCounters != nil {
+		return otpCounters
+	}
+
+	if configs.Memcache == nil {
+		return nil
+	}
+
+	return configs.Memcache
+}
+
+func readCounter(key string) (int, bool) {
+	store := counterStore()
+	if store == nil {
+		return 0, false
+	}
+
+	value, err := store.Get(key)
+	if err != nil {
+		return 0, false
+	}
+
+	count, err := strconv.Atoi(string(value))
+	return count, err == nil
+}
+
+// incrementCounter fails open, an unavailable cache must not stop people from logging in. The
+// counter expires one window after its first increment, which is also stored so the time left can
+// be told.
+func incrementCounter(key string, window time.Duration) (uint64, bool) {
+	store := counterStore()
+	if store == nil {
+		return 0, false
+	}
+
+	count, err := store.Increment(key, 1, window)
+	if err != nil {
+		log.Printf("Error incrementing %s: %v", key, err)
+		return 0, false
+	}
+
+	if count == 1 {
+		started := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+		if err := store.Set(key+":at", []byte(started), window); err != nil {
+			log.Printf("Error storing the start of %s: %v", key, err)
+		}
+	}
+
+	return count, true
+}
+
+// counterRemaining returns how long the counter's window has left, the whole window when its start
+// is unknown.
+func counterRemaining(key string, window time.Duration) time.Duration {
+	store := counterStore()
+	if store == nil {
+		return window
+	}
+
+	value, err := store.Get(key + ":at")
+	if err != nil {
+		return window
+	}
+
+	started, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return window
+	}
+
+	remaining := time.UnixMilli(started).Add(window).Sub(time.Now())
+
+	// The cache expires in whole seconds, the counter can outlive its window by a moment
+	if remaining < time.Second {
+		return time.Second
+	}
+	if remaining > window {
+		return window
+	}
+
+	return remaining
+}
+
+func resetCounter(key string) {
+	store := counterStore()
+	if store == nil {
+		return
+	}
+
+	for _, counterKey := range []string{key, key + ":at"} {
+		if err := store.Delete(counterKey); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			log.Printf("Error deleting %s: %v", counterKey, err)
+		}
+	}
+}
+
+func lockedError(retryAfter time.Duration) *OTPLimitError {
+	return &OTPLimitError{
+		Reason:     OTPLimitLocked,
+		Message:    "Too many invalid attempts. Please try again later!",
+		RetryAfter: retryAfter,
+	}
+}
+
+func parseIntEnv(name string, value string, target *int) error {
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		return fmt.Errorf("%s must be a positive number", name)
+	}
+
+	*target = parsed
+	return nil
+}
+
+func parseDurationEnv(name string, value string, target *time.Duration) error {
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("%s must be a duration like 30s or 15m", name)
+	}
+
+	*target = parsed
+	return nil
+}
@@ -0,0 +1,326 @@
+package helpers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/models"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// memoryCounters behaves like the memcache client for the counters.
+type memoryCounters struct {
+	mu    sync.Mutex
+	items map[string]memoryCounter
+}
+
+type memoryCounter struct {
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryCounters() *memoryCounters {
+	return &memoryCounters{items: map[string]memoryCounter{}}
+}
+
+func (m *memoryCounters) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if !ok || time.Now().After(item.expires) {
+		return nil, memcache.ErrCacheMiss
+	}
+	return item.value, nil
+}
+
+func (m *memoryCounters) Set(key string, value []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items[key] = memoryCounter{value: value, expires: time.Now().Add(expiration)}
+	return nil
+}
+
+func (m *memoryCounters) Increment(key string, delta uint64, expiration time.Duration) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if !ok || time.Now().After(item.expires) {
+		item = memoryCounter{value: []byte("0"), expires: time.Now().Add(expiration)}
+	}
+
+	count, err := strconv.ParseUint(string(item.value), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	count += delta
+	item.value = []byte(strconv.FormatUint(count, 10))
+	m.items[key] = item
+
+	return count, nil
+}
+
+func (m *memoryCounters) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.items[key]; !ok {
+		return memcache.ErrCacheMiss
+	}
+	delete(m.items, key)
+	return nil
+}
+
+// useOTPLimits installs the limits and an empty counter store for the test.
+func useOTPLimits(t *testing.T, limits OTPLimits) *memoryCounters {
+	t.Helper()
+
+	previousLimits, previousStore := otpLimits, otpCounters
+	t.Cleanup(func() {
+		otpLimits, otpCounters = previousLimits, previousStore
+	})
+
+	counters := newMemoryCounters()
+	otpLimits = limits
+	SetOTPCounterStore(counters)
+
+	return counters
+}
+
+var testOTPLimits = OTPLimits{
+	MaxAttempts:     3,
+	MaxSends:        2,
+	SendWindow:      time.Hour,
+	ResendCooldown:  time.Minute,
+	LockoutDuration: 15 * time.Minute,
+}
+
+func limitError(t *testing.T, err error, reason string) *OTPLimitError {
+	t.Helper()
+
+	var limitErr *OTPLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("got %v, want an *OTPLimitError", err)
+	}
+	if limitErr.Reason != reason {
+		t.Fatalf("reason = %s, want %s", limitErr.Reason, reason)
+	}
+
+	return limitErr
+}
+
+func TestInitOTPLimits(t *testing.T) {
+	useOTPLimits(t, testOTPLimits)
+
+	err := InitOTPLimits(configs.EnvConfig{OTP_MAX_ATTEMPTS: "7", OTP_SEND_WINDOW: "30m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := GetOTPLimits()
+	if limits.MaxAttempts != 7 || limits.SendWindow != 30*time.Minute || limits.MaxSends != testOTPLimits.MaxSends {
+		t.Errorf("limits = %+v", limits)
+	}
+
+	for _, env := range []configs.EnvConfig{
+		{OTP_MAX_ATTEMPTS: "0"},
+		{OTP_MAX_SENDS: "many"},
+		{OTP_COOLDOWN: "a minute"},
+		{OTP_LOCKOUT: "-5m"},
+	} {
+		if err := InitOTPLimits(env); err == nil {
+			t.Errorf("InitOTPLimits(%+v) succeeded, want an error", env)
+		}
+	}
+}
+
+func TestCheckOTPSend(t *testing.T) {
+	useOTPLimits(t, testOTPLimits)
+	now := time.Now()
+
+	throttle := &models.OtpThrottle{}
+
+	if err := CheckOTPSend(throttle, now); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	RecordOTPSend(throttle, now)
+
+	limitErr := limitError(t, CheckOTPSend(throttle, now.Add(20*time.Second)), OTPLimitCooldown)
+	if limitErr.RetryAfter != 40*time.Second {
+		t.Errorf("cooldown RetryAfter = %v, want 40s", limitErr.RetryAfter)
+	}
+
+	second := now.Add(2 * time.Minute)
+	if err := CheckOTPSend(throttle, second); err != nil {
+		t.Fatalf("second send: %v", err)
+	}
+	RecordOTPSend(throttle, second)
+
+	limitErr = limitError(t, CheckOTPSend(throttle, now.Add(10*time.Minute)), OTPLimitSends)
+	if limitErr.RetryAfter != 50*time.Minute {
+		t.Errorf("send window RetryAfter = %v, want 50m", limitErr.RetryAfter)
+	}
+
+	// A new window starts once the old one is over
+	later := now.Add(time.Hour)
+	if err := CheckOTPSend(throttle, later); err != nil {
+		t.Fatalf("send in the next window: %v", err)
+	}
+	RecordOTPSend(throttle, later)
+
+	if throttle.SendCount != 1 || !throttle.SendWindowAt.Equal(later) {
+		t.Errorf("window not restarted: count %d, window %v", throttle.SendCount, throttle.SendWindowAt)
+	}
+}
+
+func TestRecordOTPFailure(t *testing.T) {
+	useOTPLimits(t, testOTPLimits)
+	now := time.Now()
+
+	throttle := &models.OtpThrottle{}
+
+	for i := 1; i < testOTPLimits.MaxAttempts; i++ {
+		if err := RecordOTPFailure(throttle, now); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+	}
+
+	limitError(t, RecordOTPFailure(throttle, now), OTPLimitLocked)
+
+	limitErr := limitError(t, CheckOTPVerify(throttle, now.Add(5*time.Minute)), OTPLimitLocked)
+	if limitErr.RetryAfter != 10*time.Minute {
+		t.Errorf("lock RetryAfter = %v, want 10m", limitErr.RetryAfter)
+	}
+
+	limitError(t, CheckOTPSend(throttle, now.Add(5*time.Minute)), OTPLimitLocked)
+
+	if err := CheckOTPVerify(throttle, now.Add(15*time.Minute)); err != nil {
+		t.Errorf("still locked after the lockout: %v", err)
+	}
+
+	// Sending a new code starts the attempts over
+	RecordOTPSend(throttle, now.Add(15*time.Minute))
+	if throttle.Attempts != 0 {
+		t.Errorf("attempts = %d after a new code, want 0", throttle.Attempts)
+	}
+}
+
+func TestMobileOTPSendLimit(t *testing.T) {
+	counters := useOTPLimits(t, testOTPLimits)
+	mobile := "+919876543210"
+
+	// Checking alone never uses up the limit, only sends that happened count
+	for i := 0; i < 5; i++ {
+		if err := CheckMobileOTPSend(mobile); err != nil {
+			t.Fatalf("check %d: %v", i, err)
+		}
+	}
+
+	for i := 0; i < testOTPLimits.MaxSends; i++ {
+		if err := CheckMobileOTPSend(mobile); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+		RecordMobileOTPSend(mobile)
+	}
+
+	// Pretend the window started 40 minutes ago
+	counters.Set("otp:send:"+mobile+":at", []byte(strconv.FormatInt(time.Now().Add(-40*time.Minute).UnixMilli(), 10)), time.Hour)
+
+	limitErr := limitError(t, CheckMobileOTPSend(mobile), OTPLimitSends)
+	if limitErr.RetryAfter > 20*time.Minute || limitErr.RetryAfter < 19*time.Minute {
+		t.Errorf("RetryAfter = %v, want the 20 minutes left in the window", limitErr.RetryAfter)
+	}
+
+	if err := CheckMobileOTPSend("+447911123456"); err != nil {
+		t.Errorf("the limit leaked to another number: %v", err)
+	}
+
+	// The email limit is separate from the mobile one
+	if err := CheckEmailOTPSend("someone@example.com"); err != nil {
+		t.Errorf("email send: %v", err)
+	}
+}
+
+func TestMobileOTPFailureLock(t *testing.T) {
+	counters := useOTPLimits(t, testOTPLimits)
+	mobile := "+919876543210"
+
+	for i := 1; i < testOTPLimits.MaxAttempts; i++ {
+		if err := RecordMobileOTPFailure(mobile); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+	}
+
+	limitErr := limitError(t, RecordMobileOTPFailure(mobile), OTPLimitLocked)
+	if limitErr.RetryAfter > testOTPLimits.LockoutDuration || limitErr.RetryAfter < testOTPLimits.LockoutDuration-time.Second {
+		t.Errorf("RetryAfter = %v, want about %v", limitErr.RetryAfter, testOTPLimits.LockoutDuration)
+	}
+
+	limitError(t, CheckMobileOTPVerify(mobile), OTPLimitLocked)
+	limitError(t, CheckMobileOTPSend(mobile), OTPLimitLocked)
+
+	// The lock reports the time left since the first failure, not the whole lockout again
+	counters.Set("otp:fail:"+mobile+":at", []byte(strconv.FormatInt(time.Now().Add(-10*time.Minute).UnixMilli(), 10)), time.Hour)
+
+	limitErr = limitError(t, CheckMobileOTPVerify(mobile), OTPLimitLocked)
+	if limitErr.RetryAfter > 5*time.Minute || limitErr.RetryAfter < 5*time.Minute-time.Second {
+		t.Errorf("RetryAfter = %v, want the 5 minutes left", limitErr.RetryAfter)
+	}
+}
+
+func TestResetMobileOTPFailures(t *testing.T) {
+	useOTPLimits(t, testOTPLimits)
+	mobile := "+919876543210"
+
+	for i := 1; i < testOTPLimits.MaxAttempts; i++ {
+		RecordMobileOTPFailure(mobile)
+	}
+
+	// A correct code forgets the earlier wrong ones
+	ResetMobileOTPFailures(mobile)
+
+	for i := 1; i < testOTPLimits.MaxAttempts; i++ {
+		if err := RecordMobileOTPFailure(mobile); err != nil {
+			t.Fatalf("failure %d after the reset: %v", i, err)
+		}
+	}
+
+	if err := CheckMobileOTPVerify(mobile); err != nil {
+		t.Errorf("locked after the reset: %v", err)
+	}
+
+	// Resetting a number without failures is fine too
+	ResetMobileOTPFailures("+447911123456")
+	ResetEmailOTPFailures("someone@example.com")
+}
+
+func TestOTPLimitsFailOpenWithoutCache(t *testing.T) {
+	useOTPLimits(t, testOTPLimits)
+	SetOTPCounterStore(nil)
+
+	previous := configs.Memcache
+	configs.Memcache = nil
+	t.Cleanup(func() { configs.Memcache = previous })
+
+	for i := 0; i < 10; i++ {
+		RecordMobileOTPSend("+919876543210")
+
+		if err := RecordMobileOTPFailure("+919876543210"); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+	}
+
+	if err := CheckMobileOTPSend("+919876543210"); err != nil {
+		t.Errorf("send blocked without a cache: %v", err)
+	}
+	if err := CheckMobileOTPVerify("+919876543210"); err != nil {
+		t.Errorf("verify blocked without a cache: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package helpers
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Pages served to browsers, e.g. after clicking a link from an email.
+const (
+	PageTemplateEmailVerification = "email_verification"
+	PageTemplateSessionRevoke     = "session_revoke"
+)
+
+//go:embed templates/page
+var pageTemplateFiles embed.FS
+
+// PageData is handed to the page templates.
+type PageData map[string]interface{}
+
+var (
+	pageTemplates     map[string]map[string]*template.Template // lang -> name -> template
+	pageTemplatesErr  error
+	pageTemplatesOnce sync.Once
+)
+
+func loadPageTemplates() error {
+	pageTemplatesOnce.Do(func() {
+		pageTemplates, pageTemplatesErr = parsePageTemplates(pageTemplateFiles)
+	})
+	return pageTemplatesErr
+}
+
+// Every <lang>/<name>.html defines the title and the content block of layout.html.
+func parsePageTemplates(files fs.FS) (map[string]map[string]*template.Template, error) {
+	root := "templates/page"
+
+	layout, err := template.ParseFS(files, path.Join(root, "layout.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	pageFiles, err := fs.Glob(files, path.Join(root, "*", "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]map[string]*template.Template{}
+
+	for _, pageFile := range pageFiles {
+		lang := path.Base(path.Dir(pageFile))
+		name := strings.TrimSuffix(path.Base(pageFile), ".html")
+
+		page, err := layout.Clone()
+		if err != nil {
+			return nil, err
+		}
+
+		if page, err = page.ParseFS(files, pageFile); err != nil {
+			return nil, err
+		}
+
+		if templates[lang] == nil {
+			templates[lang] = map[string]*template.Template{}
+		}
+		templates[lang][name] = page
+	}
+
+	if len(templates[defaultEmailLang]) == 0 {
+		return nil, fmt.Errorf("no %s page templates found", defaultEmailLang)
+	}
+
+	return templates, nil
+}
+
+// PageLanguages lists the languages pages are translated to, for matching against Accept-Language.
+func PageLanguages() []string {
+	if err := loadPageTemplates(); err != nil {
+		return []string{defaultEmailLang}
+	}
+
+	langs := []string{defaultEmailLang}
+	for lang := range pageTemplates {
+		if lang != defaultEmailLang {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// RenderPage renders a page as HTML. Unknown languages fall back to English.
+func RenderPage(name string, lang string, data PageData) (string, error) {
+	if err := loadPageTemplates(); err != nil {
+		return "", err
+	}
+
+	lang = strings.ToLower(lang)
+
+	page, ok := pageTemplates[lang][name]
+	if !ok {
+		lang = defaultEmailLang
+		page, ok = pageTemplates[lang][name]
+	}
+	if !ok {
+		return "", fmt.Errorf("unknown page template: %s", name)
+	}
+
+	values := PageData{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Lang"] = lang
+
+	var html bytes.Buffer
+
+	if err := page.ExecuteTemplate(&html, "layout.html", values); err != nil {
+		return "", err
+	}
+
+	return html.String(), nil
+}
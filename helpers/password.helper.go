@@ -0,0 +1,25 @@
+package helpers
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordCost = 12
+
+// HashPassword returns the bcrypt hash stored in Account.Password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// ComparePassword reports whether the password matches the hash. An account without a
+// password never matches.
+func ComparePassword(hash string, password string) bool {
+	if hash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,178 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultCountryCode is used for numbers sent without a country code, matching the default of
+// Account.CountryCode.
+const DefaultCountryCode = "+91"
+
+var (
+	ErrPhoneInvalid     = errors.New("Invalid mobile number. Please check the number and country code!")
+	ErrPhoneCountryCode = errors.New("Unsupported country code!")
+)
+
+// phoneRule is the length of the national significant number, without trunk prefix.
+type phoneRule struct {
+	min   int
+	max   int
+	trunk string // dialled before national numbers inside the country, dropped when normalizing
+}
+
+// phoneRules maps calling codes to their number lengths. Calling codes are prefix free, so a
+// number starting with one of them can only belong to that country.
+var phoneRules = map[string]phoneRule{
+	"1":   {10, 10, "1"}, // US, Canada and the rest of NANP
+	"7":   {10, 10, "8"},
+	"20":  {10, 10, "0"},
+	"27":  {9, 9, "0"},
+	"30":  {10, 10, ""},
+	"31":  {9, 9, "0"},
+	"32":  {8, 9, "0"},
+	"33":  {9, 9, "0"},
+	"34":  {9, 9, ""},
+	"39":  {6, 11, ""}, // Italian landlines keep their leading zero
+	"41":  {9, 9, "0"},
+	"44":  {10, 10, "0"},
+	"45":  {8, 8, ""},
+	"46":  {7, 9, "0"},
+	"47":  {8, 8, ""},
+	"48":  {9, 9, ""},
+	"49":  {6, 11, "0"},
+	"52":  {10, 10, ""},
+	"55":  {10, 11, "0"},
+	"60":  {9, 10, "0"},
+	"61":  {9, 9, "0"},
+	"62":  {9, 12, "0"},
+	"63":  {10, 10, "0"},
+	"64":  {8, 10, "0"},
+	"65":  {8, 8, ""},
+	"66":  {9, 9, "0"},
+	"81":  {10, 10, "0"},
+	"82":  {9, 10, "0"},
+	"84":  {9, 10, "0"},
+	"86":  {11, 11, "0"},
+	"90":  {10, 10, "0"},
+	"91":  {10, 10, "0"},
+	"92":  {10, 10, "0"},
+	"94":  {9, 9, "0"},
+	"234": {10, 10, "0"},
+	"254": {9, 9, "0"},
+	"880": {10, 10, "0"},
+	"966": {9, 9, "0"},
+	"971": {9, 9, "0"},
+	"977": {10, 10, "0"},
+}
+
+// PhoneNumber is a parsed number. CountryCode has the leading plus, e.g. "+91".
+type PhoneNumber struct {
+	CountryCode string
+	National    string
+}
+
+// E164 formats the number as +<country code><national number>.
+func (p PhoneNumber) E164() string {
+	return p.CountryCode + p.National
+}
+
+// ParsePhone parses a number in international form (+44..., 0044...) or a national number together
+// with its country code. An empty country code falls back to DefaultCountryCode. Both forms accept
+// only the calling codes in phoneRules.
+func ParsePhone(number string, countryCode string) (PhoneNumber, error) {
+	number = stripPhoneFormatting(number)
+
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+
+	if strings.HasPrefix(number, "+") {
+		digits := number[1:]
+
+		if !isDigits(digits) {
+			return PhoneNumber{}, ErrPhoneInvalid
+		}
+
+		for size := 1; size <= 3 && size < len(digits); size++ {
+			if rule, ok := phoneRules[digits[:size]]; ok {
+				return checkPhone(digits[:size], digits[size:], rule, false)
+			}
+		}
+
+		return PhoneNumber{}, ErrPhoneCountryCode
+	}
+
+	if countryCode == "" {
+		countryCode = DefaultCountryCode
+	}
+
+	code := strings.TrimPrefix(stripPhoneFormatting(countryCode), "+")
+
+	if code == "" || len(code) > 3 || !isDigits(code) || code[0] == '0' {
+		return PhoneNumber{}, ErrPhoneCountryCode
+	}
+
+	if !isDigits(number) {
+		return PhoneNumber{}, ErrPhoneInvalid
+	}
+
+	rule, ok := phoneRules[code]
+
+	if !ok {
+		return PhoneNumber{}, ErrPhoneCountryCode
+	}
+
+	return checkPhone(code, number, rule, true)
+}
+
+// NormalizePhone returns the E.164 form of the number, see ParsePhone.
+func NormalizePhone(number string, countryCode string) (string, error) {
+	phone, err := ParsePhone(number, countryCode)
+
+	if err != nil {
+		return "", err
+	}
+
+	return phone.E164(), nil
+}
+
+func checkPhone(code string, national string, rule phoneRule, dialledNationally bool) (PhoneNumber, error) {
+	// The trunk prefix is only ever dialled from inside the country. It is kept when the rest would not
+	// be a valid number on its own.
+	if dialledNationally && rule.trunk != "" && strings.HasPrefix(national, rule.trunk) {
+		if stripped := national[len(rule.trunk):]; len(stripped) >= rule.min && len(stripped) <= rule.max {
+			national = stripped
+		}
+	}
+
+	if len(national) < rule.min || len(national) > rule.max || len(code)+len(national) > 15 {
+		return PhoneNumber{}, ErrPhoneInvalid
+	}
+
+	return PhoneNumber{CountryCode: "+" + code, National: national}, nil
+}
+
+func stripPhoneFormatting(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,56 @@
+package helpers
+
+import (
+	"ecommerce/configs"
+	"ecommerce/models"
+	"log"
+	"time"
+	_ "time/tzdata" // timezones resolve on hosts without a zoneinfo database
+)
+
+// Notifications the user asked for, like OTPs, login links, password reset and verification emails,
+// are always delivered. Everything else is only sent where AccountPreference.Allows it.
+
+// LoadPreferences returns the account's preferences, the defaults when it never changed them.
+func LoadPreferences(accountId string) (*models.AccountPreference, error) {
+	preferences := models.AccountPreference{}
+
+	result := configs.DB.Limit(1).Find(&preferences, "account_id = ?", accountId)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		preferences = models.DefaultPreferences(accountId)
+	}
+
+	return &preferences, nil
+}
+
+// NotificationPreferences loads the preferences before a notification is sent. When they can't be
+// read the defaults apply, a failing lookup shouldn't swallow security alerts.
+func NotificationPreferences(accountId string) *models.AccountPreference {
+	preferences, err := LoadPreferences(accountId)
+
+	if err != nil {
+		log.Printf("Error loading preferences of %s: %v", accountId, err)
+
+		defaults := models.DefaultPreferences(accountId)
+		return &defaults
+	}
+
+	return preferences
+}
+
+// FormatLocalTime formats a time for a notification in the user's timezone. Unknown timezones fall
+// back to UTC.
+func FormatLocalTime(t time.Time, timezone string) string {
+	location, err := time.LoadLocation(timezone)
+
+	if err != nil || timezone == "" {
+		location = time.UTC
+	}
+
+	return t.In(location).Format("02 Jan 2006 15:04 MST")
+}
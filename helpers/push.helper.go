@@ -0,0 +1,270 @@
+package helpers
+
+import (
+	"bytes"
+	"ecommerce/configs"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Push notification templates, rendered in the recipient's Account.Lang.
+const (
+	PushTemplateNewDeviceLogin = "new_device_login"
+)
+
+// PushSender delivers a notification to a device by its FCM token.
+// Every push provider we plug in has to implement this.
+type PushSender interface {
+	SendPush(message PushMessage) error
+}
+
+// PushMessage is a single notification for one device.
+type PushMessage struct {
+	Token    string            `json:"token"`
+	Title    string            `json:"title"`
+	Body     string            `json:"body"`
+	Data     map[string]string `json:"data,omitempty"`
+	Template string            `json:"template"`
+	SentAt   time.Time         `json:"sent_at"`
+}
+
+//go:embed templates/push
+var pushTemplateFiles embed.FS
+
+var pushSender PushSender = NewMemoryPushSender()
+
+var (
+	pushTemplates     map[string]map[string]*template.Template // lang -> name -> template
+	pushTemplatesErr  error
+	pushTemplatesOnce sync.Once
+)
+
+// InitPushSender selects the push driver from the env config. It is called once on startup.
+func InitPushSender(env configs.EnvConfig) error {
+	var sender PushSender
+
+	switch env.PUSH_DRIVER {
+	case "", "local":
+		// Without a spool file the notifications are only kept in memory
+		if env.PUSH_SPOOL_FILE == "" {
+			sender = NewMemoryPushSender()
+		} else {
+			sender = NewFilePushSender(env.PUSH_SPOOL_FILE)
+		}
+	case "memory":
+		sender = NewMemoryPushSender()
+	default:
+		return fmt.Errorf("unknown PUSH_DRIVER: %s", env.PUSH_DRIVER)
+	}
+
+	if env.GO_ENV == "production" {
+		log.Println("Warning: push notifications are delivered through the local driver in production")
+	}
+
+	if err := loadPushTemplates(); err != nil {
+		return err
+	}
+
+	pushSender = sender
+
+	return nil
+}
+
+// SetPushSender replaces the active driver, tests use it to install a memory outbox.
+func SetPushSender(sender PushSender) {
+	pushSender = sender
+}
+
+// GetPushSender returns the active driver.
+func GetPushSender() PushSender {
+	return pushSender
+}
+
+// SendPush renders the template in the recipient's language and sends it to every token. All tokens
+// are tried, the first error is returned.
+func SendPush(tokens []string, lang string, name string, data map[string]string) error {
+	if pushSender == nil {
+		return errors.New("push sender is not initialized")
+	}
+
+	title, body, err := renderPush(name, lang, data)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+
+	for _, token := range tokens {
+		err := pushSender.SendPush(PushMessage{
+			Token:    token,
+			Title:    title,
+			Body:     body,
+			Data:     data,
+			Template: name,
+			SentAt:   time.Now(),
+		})
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func loadPushTemplates() error {
+	pushTemplatesOnce.Do(func() {
+		pushTemplates, pushTemplatesErr = parsePushTemplates(pushTemplateFiles)
+	})
+	return pushTemplatesErr
+}
+
+// Every <lang>/<name>.txt defines the title and the body.
+func parsePushTemplates(files fs.FS) (map[string]map[string]*template.Template, error) {
+	pushFiles, err := fs.Glob(files, "templates/push/*/*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]map[string]*template.Template{}
+
+	for _, pushFile := range pushFiles {
+		lang := path.Base(path.Dir(pushFile))
+		name := strings.TrimSuffix(path.Base(pushFile), ".txt")
+
+		tmpl, err := template.ParseFS(files, pushFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if templates[lang] == nil {
+			templates[lang] = map[string]*template.Template{}
+		}
+		templates[lang][name] = tmpl
+	}
+
+	if len(templates[defaultEmailLang]) == 0 {
+		return nil, fmt.Errorf("no %s push templates found", defaultEmailLang)
+	}
+
+	return templates, nil
+}
+
+// renderPush renders the title and body of a template. Unknown languages fall back to English.
+func renderPush(name string, lang string, data map[string]string) (string, string, error) {
+	if err := loadPushTemplates(); err != nil {
+		return "", "", err
+	}
+
+	tmpl, ok := pushTemplates[strings.ToLower(lang)][name]
+	if !ok {
+		tmpl, ok = pushTemplates[defaultEmailLang][name]
+	}
+	if !ok {
+		return "", "", fmt.Errorf("unknown push template: %s", name)
+	}
+
+	var title, body bytes.Buffer
+
+	if err := tmpl.ExecuteTemplate(&title, "title", data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(title.String()), strings.TrimSpace(body.String()), nil
+}
+
+// MemoryPushSender keeps every notification in memory so tests can read them back.
+type MemoryPushSender struct {
+	mu       sync.Mutex
+	messages []PushMessage
+}
+
+func NewMemoryPushSender() *MemoryPushSender {
+	return &MemoryPushSender{}
+}
+
+func (m *MemoryPushSender) SendPush(message PushMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns a copy of the outbox.
+func (m *MemoryPushSender) Messages() []PushMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]PushMessage, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+// LastPush returns the most recent notification sent to the device.
+func (m *MemoryPushSender) LastPush(token string) (PushMessage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].Token == token {
+			return m.messages[i], true
+		}
+	}
+	return PushMessage{}, false
+}
+
+// Reset empties the outbox.
+func (m *MemoryPushSender) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
+
+// FilePushSender appends every notification as a JSON line to a spool file.
+type FilePushSender struct {
+	mu   sync.Mutex
+	Path string
+}
+
+func NewFilePushSender(path string) *FilePushSender {
+	return &FilePushSender{Path: path}
+}
+
+func (f *FilePushSender) SendPush(message PushMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
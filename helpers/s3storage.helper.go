@@ -0,0 +1,296 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3Service         = "s3"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3MaxURLExpiry    = 7 * 24 * time.Hour // presigned URLs can't live longer
+)
+
+// S3Config points S3Storage at AWS or at any S3 compatible server such as MinIO.
+type S3Config struct {
+	Endpoint  string // empty for AWS, e.g. http://localhost:9000 for a local MinIO
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // bucket in the path instead of the host name, needed by most S3 compatible servers
+}
+
+// S3Storage keeps files in an S3 bucket. Requests are signed with AWS Signature Version 4.
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY must be set")
+	}
+
+	rawEndpoint := config.Endpoint
+	if rawEndpoint == "" {
+		rawEndpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(rawEndpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT: %s", config.Endpoint)
+	}
+
+	return &S3Storage{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3Storage) Put(key string, data []byte, contentType string) error {
+	request, err := s.newRequest(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+	request.ContentLength = int64(len(data))
+
+	return s.do(request, data)
+}
+
+func (s *S3Storage) Delete(key string) error {
+	request, err := s.newRequest(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.do(request, nil)
+}
+
+// URL returns a presigned GET link.
+func (s *S3Storage) URL(key string, expires time.Time) (string, error) {
+	if err := checkStorageKey(key); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	expiresIn := expires.Sub(now)
+
+	if expiresIn > s3MaxURLExpiry {
+		expiresIn = s3MaxURLExpiry
+	}
+	if expiresIn < time.Second {
+		expiresIn = time.Second
+	}
+
+	return s.presign(key, now, expiresIn), nil
+}
+
+func (s *S3Storage) presign(key string, now time.Time, expiresIn time.Duration) string {
+	target := s.objectURL(key)
+	scope := s.scope(now)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.config.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiresIn.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + target.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(now, canonicalRequest))
+	target.RawQuery = canonicalQuery(query)
+
+	return target.String()
+}
+
+func (s *S3Storage) newRequest(method string, key string, body []byte) (*http.Request, error) {
+	if err := checkStorageKey(key); err != nil {
+		return nil, err
+	}
+
+	target := s.objectURL(key)
+
+	request, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	// The path is already escaped the way it is signed, Go must not escape it again
+	request.URL.RawPath = target.RawPath
+	request.URL.Path = target.Path
+
+	return request, nil
+}
+
+// do signs the request with the Authorization header and sends it.
+func (s *S3Storage) do(request *http.Request, body []byte) error {
+	now := time.Now().UTC()
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	var names []string
+	headers := map[string]string{}
+
+	for name, values := range request.Header {
+		lower := strings.ToLower(name)
+		if lower == "host" || lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+
+	// net/http sends the host from the URL, the header was only needed for signing
+	request.Header.Del("Host")
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("s3 %s %s failed with %d: %s", request.Method, request.URL.Path, response.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+func (s *S3Storage) objectURL(key string) *url.URL {
+	target := *s.endpoint
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	escapedKey := strings.Join(segments, "/")
+
+	basePath := strings.TrimSuffix(target.Path, "/")
+
+	if s.config.PathStyle {
+		target.RawPath = basePath + "/" + s3Escape(s.config.Bucket) + "/" + escapedKey
+		target.Path = basePath + "/" + s.config.Bucket + "/" + key
+	} else {
+		target.Host = s.config.Bucket + "." + target.Host
+		target.RawPath = basePath + "/" + escapedKey
+		target.Path = basePath + "/" + key
+	}
+
+	return &target
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.config.Region + "/" + s3Service + "/aws4_request"
+}
+
+func (s *S3Storage) signature(now time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery sorts the parameters and escapes them the way SigV4 expects.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+
+		for _, value := range values {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except the unreserved characters of RFC 3986.
+func s3Escape(value string) string {
+	var escaped strings.Builder
+
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
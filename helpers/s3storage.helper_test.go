@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newMinioStorage connects to the MinIO of docker-compose.dev.yml, or to the server in the S3_TEST_*
+// variables. The test is skipped when nothing listens there.
+func newMinioStorage(t *testing.T) *S3Storage {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping MinIO integration test in short mode")
+	}
+
+	config := S3Config{
+		Endpoint:  valueOr(os.Getenv("S3_TEST_ENDPOINT"), "http://localhost:9000"),
+		Region:    valueOr(os.Getenv("S3_TEST_REGION"), "us-east-1"),
+		Bucket:    valueOr(os.Getenv("S3_TEST_BUCKET"), "ecommerce"),
+		AccessKey: valueOr(os.Getenv("S3_TEST_ACCESS_KEY"), "minioadmin"),
+		SecretKey: valueOr(os.Getenv("S3_TEST_SECRET_KEY"), "minioadmin"),
+		PathStyle: true,
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		t.Fatalf("invalid S3_TEST_ENDPOINT: %v", err)
+	}
+
+	connection, err := net.DialTimeout("tcp", endpoint.Host, time.Second)
+	if err != nil {
+		t.Skipf("MinIO is not available at %s: %v", config.Endpoint, err)
+	}
+	connection.Close()
+
+	storage, err := NewS3Storage(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage
+}
+
+func TestS3StorageAgainstMinio(t *testing.T) {
+	storage := newMinioStorage(t)
+
+	key := "test/" + strconv.FormatInt(time.Now().UnixNano(), 36) + "/hello.txt"
+	data := []byte("hello from the storage test")
+
+	if err := storage.Put(key, data, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	t.Cleanup(func() { storage.Delete(key) })
+
+	link, err := storage.URL(key, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("URL: %v", err)
+	}
+
+	response, err := http.Get(link)
+	if err != nil {
+		t.Fatalf("GET presigned URL: %v", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET presigned URL: status %d: %s", response.StatusCode, body)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatalf("GET presigned URL returned %q, want %q", body, data)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", contentType)
+	}
+
+	if err := storage.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	response, err = http.Get(link)
+	if err != nil {
+		t.Fatalf("GET after delete: %v", err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET after delete: status %d, want 404", response.StatusCode)
+	}
+
+	// Deleting a missing object is not an error in S3
+	if err := storage.Delete(key); err != nil {
+		t.Fatalf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestS3StorageRejectsTamperedURL(t *testing.T) {
+	storage := newMinioStorage(t)
+
+	key := "test/" + strconv.FormatInt(time.Now().UnixNano(), 36) + "/secret.txt"
+
+	if err := storage.Put(key, []byte("secret"), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	t.Cleanup(func() { storage.Delete(key) })
+
+	link, err := storage.URL(key, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("URL: %v", err)
+	}
+
+	tampered, _ := url.Parse(link)
+	query := tampered.Query()
+	query.Set("X-Amz-Expires", "604800")
+	tampered.RawQuery = query.Encode()
+
+	response, err := http.Get(tampered.String())
+	if err != nil {
+		t.Fatalf("GET tampered URL: %v", err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusForbidden {
+		t.Fatalf("GET tampered URL: status %d, want 403", response.StatusCode)
+	}
+}
@@ -0,0 +1,212 @@
+package helpers
+
+import (
+	"ecommerce/configs"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStorageURLTTL = time.Hour
+
+var ErrStorageKey = errors.New("invalid storage key")
+
+// Storage keeps uploaded files. Every storage backend we plug in has to implement this.
+type Storage interface {
+	Put(key string, data []byte, contentType string) error
+	Delete(key string) error
+	// URL returns a link to the file that stops working at expires.
+	URL(key string, expires time.Time) (string, error)
+}
+
+var (
+	storage       Storage = NewMemoryStorage()
+	storageURLTTL         = defaultStorageURLTTL
+)
+
+// InitStorage selects the storage driver from the env config. It is called once on startup.
+func InitStorage(env configs.EnvConfig) error {
+	var driver Storage
+
+	switch env.STORAGE_DRIVER {
+	case "", "local":
+		if env.STORAGE_URL == "" {
+			return errors.New("STORAGE_URL is not set")
+		}
+		driver = NewLocalStorage(valueOr(env.STORAGE_LOCAL_DIR, "tmp/storage"), env.STORAGE_URL)
+	case "memory":
+		driver = NewMemoryStorage()
+	case "s3":
+		s3, err := NewS3Storage(S3Config{
+			Endpoint:  env.S3_ENDPOINT,
+			Region:    valueOr(env.S3_REGION, "us-east-1"),
+			Bucket:    env.S3_BUCKET,
+			AccessKey: env.S3_ACCESS_KEY,
+			SecretKey: env.S3_SECRET_KEY,
+			PathStyle: env.S3_PATH_STYLE == "true",
+		})
+		if err != nil {
+			return err
+		}
+		driver = s3
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER: %s", env.STORAGE_DRIVER)
+	}
+
+	ttl := defaultStorageURLTTL
+	if err := parseDurationEnv("STORAGE_URL_TTL", env.STORAGE_URL_TTL, &ttl); err != nil {
+		return err
+	}
+
+	storage = driver
+	storageURLTTL = ttl
+
+	return nil
+}
+
+// SetStorage replaces the active driver, tests use it to install a memory storage.
+func SetStorage(driver Storage) {
+	storage = driver
+}
+
+// GetStorage returns the active driver.
+func GetStorage() Storage {
+	return storage
+}
+
+// StorageURL returns a link to the file that is valid for STORAGE_URL_TTL.
+func StorageURL(key string) (string, error) {
+	return storage.URL(key, time.Now().Add(storageURLTTL))
+}
+
+// checkStorageKey rejects keys that could escape the storage root.
+func checkStorageKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return ErrStorageKey
+	}
+	return nil
+}
+
+// LocalStorage keeps files in a directory. The API serves them itself, the links are signed with
+// SignedURL.
+type LocalStorage struct {
+	Dir     string
+	BaseURL string // where the files route is mounted, e.g. http://localhost:8000/api/v1/files
+}
+
+func NewLocalStorage(dir string, baseURL string) *LocalStorage {
+	return &LocalStorage{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Path returns the file of the key on disk.
+func (l *LocalStorage) Path(key string) (string, error) {
+	if err := checkStorageKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+func (l *LocalStorage) Put(key string, data []byte, contentType string) error {
+	file, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	// Written to a temporary file and moved, so readers never see half a file
+	tmpFile := file + ".tmp"
+
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, file)
+}
+
+func (l *LocalStorage) Delete(key string) error {
+	file, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalStorage) URL(key string, expires time.Time) (string, error) {
+	if err := checkStorageKey(key); err != nil {
+		return "", err
+	}
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return SignedURL(l.BaseURL+"/"+strings.Join(segments, "/"), StorageResource(key), expires), nil
+}
+
+// StorageResource is what links to a locally stored file are signed for.
+func StorageResource(key string) string {
+	return "file:" + key
+}
+
+// MemoryStorage keeps files in memory so tests can read uploads back.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	files map[string]MemoryFile
+}
+
+// MemoryFile is a file kept by MemoryStorage.
+type MemoryFile struct {
+	Data        []byte
+	ContentType string
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: map[string]MemoryFile{}}
+}
+
+func (m *MemoryStorage) Put(key string, data []byte, contentType string) error {
+	if err := checkStorageKey(key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[key] = MemoryFile{Data: append([]byte(nil), data...), ContentType: contentType}
+	return nil
+}
+
+func (m *MemoryStorage) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.files, key)
+	return nil
+}
+
+func (m *MemoryStorage) URL(key string, expires time.Time) (string, error) {
+	return fmt.Sprintf("memory://%s?expires=%d", key, expires.Unix()), nil
+}
+
+// File returns a stored file.
+func (m *MemoryStorage) File(key string) (MemoryFile, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, ok := m.files[key]
+	return file, ok
+}
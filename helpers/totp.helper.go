@@ -0,0 +1,229 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"ecommerce/configs"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits      = 6
+	totpPeriod      = 30 // seconds
+	totpSkew        = 1  // steps accepted before and after the current one
+	totpSecretBytes = 20
+
+	recoveryCodeCount = 10
+
+	defaultTOTPIssuer = "Ecommerce"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var (
+	twoFactorKey []byte
+	totpIssuer   = defaultTOTPIssuer
+)
+
+// GenerateTOTPSecret returns a new base32 encoded secret for an authenticator app.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretBytes)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI builds the otpauth:// URI that authenticator apps read from a QR code.
+func TOTPURI(secret string, issuer string, accountName string) string {
+	label := url.PathEscape(issuer + ":" + accountName)
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// ValidateTOTP checks a code against the secret (RFC 6238). Codes from a step at or before lastStep
+// were already used, so a code can only be used once. The matched step is returned.
+func ValidateTOTP(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes returns single use codes in the form xxxxx-xxxxx.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		raw := make([]byte, 7)
+
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode lets users type recovery codes without the dash and in any case.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+
+	if len(code) != 10 {
+		return code
+	}
+
+	return code[:5] + "-" + code[5:]
+}
+
+// InitTwoFactor sets the key TOTP secrets are sealed with. It is separate from OTP_HASH_SECRET
+// so that rotating the OTP secret does not lock everyone out of their authenticator.
+func InitTwoFactor(env configs.EnvConfig) error {
+	if env.TWO_FACTOR_SECRET == "" {
+		return errors.New("TWO_FACTOR_SECRET is not set")
+	}
+
+	sum := sha256.Sum256([]byte("totp-secret:" + env.TWO_FACTOR_SECRET))
+	twoFactorKey = sum[:]
+	totpIssuer = valueOr(env.TOTP_ISSUER, defaultTOTPIssuer)
+
+	return nil
+}
+
+// TOTPIssuer is the name authenticator apps show next to the account.
+func TOTPIssuer() string {
+	return totpIssuer
+}
+
+// EncryptSecret seals a TOTP secret with AES-GCM before it is stored.
+func EncryptSecret(plain string) (string, error) {
+	return sealSecret(twoFactorKey, plain)
+}
+
+// DecryptSecret opens a value sealed by EncryptSecret.
+func DecryptSecret(sealed string) (string, error) {
+	return openSecret(twoFactorKey, sealed)
+}
+
+// ResealSecret moves a secret sealed with the key derived from the OTP hash secret, which was used
+// before TWO_FACTOR_SECRET existed, to the current key. It reports whether the value changed.
+func ResealSecret(sealed string) (string, bool, error) {
+	if _, err := openSecret(twoFactorKey, sealed); err == nil {
+		return sealed, false, nil
+	}
+
+	legacy := sha256.Sum256(append([]byte("totp-secret:"), otpHashKey...))
+
+	plain, err := openSecret(legacy[:], sealed)
+	if err != nil {
+		return "", false, err
+	}
+
+	resealed, err := EncryptSecret(plain)
+	if err != nil {
+		return "", false, err
+	}
+
+	return resealed, true, nil
+}
+
+func sealSecret(key []byte, plain string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSecret(key []byte, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("sealed secret is too short")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
@@ -0,0 +1,29 @@
+package helpers
+
+import (
+	"ecommerce/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrTokenUsed is returned by ConsumeToken for a single use token that was accepted before.
+var ErrTokenUsed = errors.New("token was already used")
+
+// ConsumeToken records the jti of a single use token. Only the first call for a token succeeds, the
+// primary key on the jti keeps that true across concurrent requests and instances. Pass a transaction
+// to give the token back when the action it authorizes fails.
+func ConsumeToken(db *gorm.DB, claims *TokenClaims) error {
+	err := db.Create(&models.UsedToken{
+		TokenID:   claims.ID,
+		AccountID: claims.UserId,
+		Type:      claims.Type,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}).Error
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrTokenUsed
+	}
+
+	return err
+}
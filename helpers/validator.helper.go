@@ -10,6 +10,7 @@ type ErrorResponse struct {
 
 func ValidateStruct[T any](payload T) []*ErrorResponse {
 	var validate = validator.New()
+	validate.RegisterCustomTypeFunc(optionalValue, optionalTypes...)
 
 	var errors []*ErrorResponse
 	err := validate.Struct(payload)
@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Name left on anonymized accounts, order history still shows something readable.
+const deletedAccountName = "Deleted user"
+
+// DeleteScheduledAccounts anonymizes every account whose deletion grace period is over. The account
+// row stays so orders keep their reference, only its personal data is removed.
+func DeleteScheduledAccounts(db *gorm.DB, now time.Time) error {
+	var accounts []models.Account
+
+	err := db.Select("id").
+		Where("is_deleted = ? AND deletion_scheduled_at > ? AND deletion_scheduled_at <= ?", false, time.Time{}, now).
+		Find(&accounts).Error
+
+	if err != nil {
+		return err
+	}
+
+	deleted := 0
+
+	for _, account := range accounts {
+		ok, err := deleteAccount(db, account.ID, now)
+
+		if err != nil {
+			log.Printf("Error deleting account %s: %v", account.ID, err)
+			continue
+		}
+
+		if ok {
+			helpers.InvalidateAccount(account.ID)
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d accounts", deleted)
+	}
+
+	return nil
+}
+
+// deleteAccount anonymizes one account. The account update only matches while the deletion is still
+// due, so a cancellation or another instance running the job makes it a no-op.
+func deleteAccount(db *gorm.DB, accountId string, now time.Time) (bool, error) {
+	deleted := false
+	var exportFiles []string
+	var profileImage string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Account{}).Select("profile_image").Where("id = ?", accountId).Scan(&profileImage).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Account{}).
+			Where("id = ? AND is_deleted = ? AND deletion_scheduled_at > ? AND deletion_scheduled_at <= ?", accountId, false, time.Time{}, now).
+			Updates(map[string]interface{}{
+				"name":                  deletedAccountName,
+				"email":                 nil,
+				"pending_email":         "",
+				"mobile":                nil,
+				"password":              "",
+				"google_id":             "",
+				"apple_id":              "",
+				"profile_image":         "",
+				"lat":                   0,
+				"long":                  0,
+				"is_logged_in":          false,
+				"is_mobile_verified":    false,
+				"is_email_verified":     false,
+				"is_blocked_reason":     "",
+				"is_blacklisted_reason": "",
+				"is_deleted":            true,
+				"deleted_at":            now,
+				"updated_at":            now,
+			})
+
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		err := tx.Model(&models.Address{}).Where("account_id = ? AND is_deleted = ?", accountId, false).Updates(map[string]interface{}{
+			"is_deleted": true,
+			"deleted_at": now,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		// Orders keep referring to the addresses, including ones deleted earlier, only the parts that
+		// identify the person go
+		err = tx.Model(&models.Address{}).Where("account_id = ?", accountId).Updates(map[string]interface{}{
+			"full_name":     "",
+			"phone_number":  "",
+			"address_line1": "",
+			"address_line2": "",
+			"lat":           0,
+			"long":          0,
+			"updated_at":    now,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		// The history stays, the append only triggers let exactly these columns be blanked
+		err = tx.Model(&models.AuthEvent{}).Where("account_id = ?", accountId).Updates(map[string]interface{}{
+			"ip":         "",
+			"user_agent": "",
+			"fcm":        "",
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.AccountBlockEvent{}).Where("account_id = ?", accountId).Update("notes", "").Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.DataExport{}).Where("account_id = ? AND file_path <> ''", accountId).Pluck("file_path", &exportFiles).Error; err != nil {
+			return err
+		}
+
+		// Nothing else refers to these rows, they go completely
+		for _, model := range []interface{}{
+			&models.DataExport{},
+			&models.UserLogin{},
+			&models.UserOtp{},
+			&models.AccountTwoFactor{},
+			&models.TwoFactorRecoveryCode{},
+			&models.MobileChangeRequest{},
+			&models.AccountRole{},
+			&models.AccountPreference{},
+			&models.UsedToken{},
+		} {
+			if err := tx.Where("account_id = ?", accountId).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		deleted = true
+
+		return tx.Create(&models.AuthEvent{AccountID: accountId, Type: models.AuthEventDeletion, Detail: "deleted"}).Error
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	// Export archives and profile images hold personal data too, they go once the rows are committed
+	for _, file := range exportFiles {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing data export %s: %v", file, err)
+		}
+	}
+
+	if deleted {
+		for _, key := range helpers.ProfileImageKeys(profileImage) {
+			if err := helpers.GetStorage().Delete(key); err != nil {
+				log.Printf("Error removing profile image %s: %v", key, err)
+			}
+		}
+	}
+
+	return deleted, nil
+}
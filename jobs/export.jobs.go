@@ -0,0 +1,257 @@
+package jobs
+
+import (
+	"archive/zip"
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// An export still building after this long belongs to an instance that died, another one takes over.
+const staleExportAfter = 30 * time.Minute
+
+var dataExportWake = make(chan struct{}, 1)
+
+// WakeDataExports makes the export job look for new requests right away instead of on its next tick.
+func WakeDataExports() {
+	select {
+	case dataExportWake <- struct{}{}:
+	default:
+	}
+}
+
+// DataExportLink is the signed download link of a ready export.
+func DataExportLink(export *models.DataExport) string {
+	link := fmt.Sprintf("%s/%s/download", helpers.GetDataExportSettings().URL, export.ID)
+	return helpers.SignedURL(link, DataExportResource(export.ID), export.ExpiresAt)
+}
+
+// DataExportResource is what download links of the export are signed for.
+func DataExportResource(exportId string) string {
+	return "data_export:" + exportId
+}
+
+// BuildDataExports builds the archives of every requested export and emails the download link.
+func BuildDataExports(db *gorm.DB, now time.Time) error {
+	var exports []models.DataExport
+
+	err := db.Where("status = ? OR (status = ? AND updated_at < ?)", models.DataExportPending, models.DataExportBuilding, now.Add(-staleExportAfter)).
+		Order("created_at").
+		Find(&exports).Error
+
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		// Only one instance may claim the export
+		claim := db.Model(&models.DataExport{}).Where("id = ? AND status = ? AND updated_at = ?", export.ID, export.Status, export.UpdatedAt).Updates(map[string]interface{}{
+			"status":     models.DataExportBuilding,
+			"updated_at": time.Now(),
+		})
+
+		if claim.Error != nil {
+			log.Printf("Error claiming data export %s: %v", export.ID, claim.Error)
+			continue
+		}
+
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		if err := buildDataExport(db, &export); err != nil {
+			log.Printf("Error building data export %s: %v", export.ID, err)
+
+			db.Model(&models.DataExport{}).Where("id = ?", export.ID).Updates(map[string]interface{}{
+				"status":     models.DataExportFailed,
+				"updated_at": time.Now(),
+			})
+		}
+	}
+
+	return nil
+}
+
+// ExpireDataExports removes the archives whose link expired.
+func ExpireDataExports(db *gorm.DB, now time.Time) error {
+	var exports []models.DataExport
+
+	if err := db.Where("status = ? AND expires_at <= ?", models.DataExportReady, now).Find(&exports).Error; err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing data export %s: %v", export.ID, err)
+			continue
+		}
+
+		db.Model(&models.DataExport{}).Where("id = ?", export.ID).Updates(map[string]interface{}{
+			"status":     models.DataExportExpired,
+			"file_path":  "",
+			"updated_at": time.Now(),
+		})
+	}
+
+	return nil
+}
+
+func buildDataExport(db *gorm.DB, export *models.DataExport) error {
+	account := models.Account{}
+
+	if err := db.First(&account, "id = ?", export.AccountID).Error; err != nil {
+		return err
+	}
+
+	settings := helpers.GetDataExportSettings()
+
+	if err := os.MkdirAll(settings.Dir, 0o700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(settings.Dir, export.ID+".zip")
+	tmpPath := path + ".tmp"
+
+	size, err := writeDataExport(db, &account, tmpPath)
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	now := time.Now()
+
+	export.Status = models.DataExportReady
+	export.FilePath = path
+	export.Size = size
+	export.CompletedAt = now
+	export.ExpiresAt = now.Add(settings.TTL)
+
+	err = db.Model(&models.DataExport{}).Where("id = ?", export.ID).Updates(map[string]interface{}{
+		"status":       export.Status,
+		"file_path":    export.FilePath,
+		"size":         export.Size,
+		"completed_at": export.CompletedAt,
+		"expires_at":   export.ExpiresAt,
+		"updated_at":   now,
+	}).Error
+
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	preferences := helpers.NotificationPreferences(account.ID)
+
+	// The user asked for the export, so the email goes out whatever the preferences say. Without a
+	// verified email the user finds the link in the app.
+	if account.Email != "" && account.IsEmailVerified {
+		data := helpers.EmailData{
+			"Link":      DataExportLink(export),
+			"ExpiresAt": helpers.FormatLocalTime(export.ExpiresAt, preferences.Timezone),
+		}
+
+		if err := helpers.SendEmail(account.Email, account.Lang, helpers.EmailTemplateDataExportReady, data); err != nil {
+			log.Printf("Error sending data export email: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// writeDataExport writes every table that holds data of the account into a ZIP archive and returns its size.
+func writeDataExport(db *gorm.DB, account *models.Account, path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	var (
+		addresses     []models.Address
+		sessions      []models.UserLogin
+		otps          []models.UserOtp
+		twoFactor     []models.AccountTwoFactor
+		recoveryCodes []models.TwoFactorRecoveryCode
+		mobileChanges []models.MobileChangeRequest
+		blockEvents   []models.AccountBlockEvent
+		authEvents    []models.AuthEvent
+		dataExports   []models.DataExport
+		preferences   []models.AccountPreference
+		roles         []exportedRole
+	)
+
+	byAccount := func(rows interface{}) error {
+		return db.Where("account_id = ?", account.ID).Order("created_at").Find(rows).Error
+	}
+
+	// Soft deleted addresses are the user's data too
+	for _, rows := range []interface{}{&addresses, &sessions, &otps, &twoFactor, &recoveryCodes, &mobileChanges, &blockEvents, &authEvents, &dataExports, &preferences} {
+		if err := byAccount(rows); err != nil {
+			return 0, err
+		}
+	}
+
+	err = db.Model(&models.AccountRole{}).
+		Select("roles.name AS role, account_roles.created_at AS granted_at").
+		Joins("JOIN roles ON roles.id = account_roles.role_id").
+		Where("account_roles.account_id = ?", account.ID).
+		Scan(&roles).Error
+
+	if err != nil {
+		return 0, err
+	}
+
+	tables := []struct {
+		name string
+		rows interface{}
+	}{
+		{"account", []models.Account{*account}},
+		{"addresses", addresses},
+		{"sessions", sessions},
+		{"otps", otps},
+		{"two_factor", twoFactor},
+		{"two_factor_recovery_codes", recoveryCodes},
+		{"roles", roles},
+		{"mobile_change_requests", mobileChanges},
+		{"block_history", blockEvents},
+		{"security_events", authEvents},
+		{"data_exports", dataExports},
+		{"preferences", preferences},
+	}
+
+	for _, table := range tables {
+		if err := helpers.WriteExportTable(archive, table.name, table.rows); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), file.Close()
+}
+
+type exportedRole struct {
+	Role      string    `json:"role"`
+	GrantedAt time.Time `json:"granted_at"`
+}
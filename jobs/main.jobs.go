@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Requests are picked up right away through WakeDataExports, the interval only catches the rest.
+const dataExportInterval = time.Minute
+
+const usedTokenInterval = time.Hour
+
+// Start runs the background jobs until the process exits. Every job has to be safe to run on several
+// instances at once.
+func Start(db *gorm.DB, deletionInterval time.Duration) {
+	log.Println("Starting Jobs")
+
+	go every(deletionInterval, nil, "account deletion", func() error {
+		return DeleteScheduledAccounts(db, time.Now())
+	})
+
+	go every(dataExportInterval, dataExportWake, "data export", func() error {
+		return BuildDataExports(db, time.Now())
+	})
+
+	go every(dataExportInterval, nil, "data export expiry", func() error {
+		return ExpireDataExports(db, time.Now())
+	})
+
+	go every(usedTokenInterval, nil, "used token cleanup", func() error {
+		return DeleteExpiredUsedTokens(db, time.Now())
+	})
+}
+
+// every runs the job now and then on every tick, or earlier when woken.
+func every(interval time.Duration, wake <-chan struct{}, name string, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Printf("Job %s failed: %v", name, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
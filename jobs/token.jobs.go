@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"ecommerce/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeleteExpiredUsedTokens drops the jti records of single use tokens that have expired anyway.
+func DeleteExpiredUsedTokens(db *gorm.DB, now time.Time) error {
+	result := db.Where("expires_at < ?", now).Delete(&models.UsedToken{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		log.Printf("Deleted %d expired used tokens", result.RowsAffected)
+	}
+
+	return nil
+}
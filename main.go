@@ -2,7 +2,10 @@ package main
 
 import (
 	configs "ecommerce/configs"
+	"ecommerce/helpers"
+	"ecommerce/jobs"
 	app_middlewares "ecommerce/middlewares"
+	"ecommerce/migrations"
 	"ecommerce/routes"
 	"log"
 
@@ -23,6 +26,58 @@ func main() {
 
 	configs.InitMemeCache(envConfig.MEMECACHE_SERVER)
 
+	if err := helpers.InitJWTKeys(envConfig); err != nil {
+		log.Fatal("Failed to load JWT keys! \n", err.Error())
+	}
+
+	if err := helpers.InitOTPSender(envConfig); err != nil {
+		log.Fatal("Failed to initialize OTP sender! \n", err.Error())
+	}
+
+	if err := helpers.InitTwoFactor(envConfig); err != nil {
+		log.Fatal("Failed to initialize two factor authentication! \n", err.Error())
+	}
+
+	if err := helpers.InitEmailSender(envConfig); err != nil {
+		log.Fatal("Failed to initialize email sender! \n", err.Error())
+	}
+
+	if err := helpers.InitPushSender(envConfig); err != nil {
+		log.Fatal("Failed to initialize push sender! \n", err.Error())
+	}
+
+	if err := helpers.InitOTPLimits(envConfig); err != nil {
+		log.Fatal("Failed to initialize OTP limits! \n", err.Error())
+	}
+
+	if err := helpers.InitAccountDeletion(envConfig); err != nil {
+		log.Fatal("Failed to initialize account deletion! \n", err.Error())
+	}
+
+	if err := helpers.InitAppLinks(envConfig); err != nil {
+		log.Fatal("Failed to load app links! \n", err.Error())
+	}
+
+	if err := helpers.InitURLSigning(envConfig); err != nil {
+		log.Fatal("Failed to initialize URL signing! \n", err.Error())
+	}
+
+	if err := helpers.InitDataExports(envConfig); err != nil {
+		log.Fatal("Failed to initialize data exports! \n", err.Error())
+	}
+
+	if err := helpers.InitStorage(envConfig); err != nil {
+		log.Fatal("Failed to initialize storage! \n", err.Error())
+	}
+
+	helpers.InitOAuthVerifiers(envConfig)
+
+	if err := migrations.Run(configs.DB, envConfig); err != nil {
+		log.Fatal("Data migration failed! \n", err.Error())
+	}
+
+	jobs.Start(configs.DB, helpers.GetAccountDeletion().JobInterval)
+
 	app_middlewares.TopLevelMiddleware(app) //setup middlewares
 	routes.InitRoutes(app)                  //setup routes
 	app_middlewares.ErrorMiddleware(app)    //parse errors
@@ -1,12 +1,19 @@
 package middlewares
 
 import (
+	"ecommerce/configs"
 	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+const lastSeenInterval = 5 * time.Minute
+
 func IsAuthenticated(c *fiber.Ctx) error {
 
 	authHeader := c.Get("Authorization")
@@ -19,11 +26,11 @@ func IsAuthenticated(c *fiber.Ctx) error {
 	}
 
 	authHeader = strings.Replace(authHeader, "Bearer ", "", -1)
-	validToken, err := helpers.ParseToken(authHeader)
+	validToken, err := helpers.ParseToken(authHeader, helpers.TokenTypeAccess)
 
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": strings.Split(err.Error(), "token has invalid claims: ")[1],
+			"message": strings.TrimPrefix(err.Error(), "token has invalid claims: "),
 			"success": false,
 		})
 	}
@@ -35,9 +42,76 @@ func IsAuthenticated(c *fiber.Ctx) error {
 		})
 	}
 
+	// Tokens are bound to a login so that logging out revokes them right away
+	if validToken.SessionId == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Session expired. Please login",
+			"success": false,
+		})
+	}
+
+	session := models.UserLogin{}
+	result := configs.DB.Select("id", "is_active", "last_seen_at").Limit(1).Find(&session, "id = ? AND account_id = ?", validToken.SessionId, validToken.UserId)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 || !session.IsActive {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Session has been revoked. Please login",
+			"success": false,
+		})
+	}
+
+	account, err := helpers.LoadAccount(validToken.UserId)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Please login",
+			"success": false,
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Deletion drops the sessions, this only catches tokens checked while the deletion runs
+	if account.IsDeleted {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Please login",
+			"success": false,
+		})
+	}
+
+	// Blocking revokes the sessions too, this also covers blocks that were set outside the API
+	if account.BlockActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Account blocked! Please contact support",
+			"success": false,
+		})
+	}
+
+	if account.BlacklistActive() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Account blacklisted! Please contact support",
+			"success": false,
+		})
+	}
+
+	// Keep the last seen time roughly up to date without writing on every request
+	if time.Since(session.LastSeenAt) > lastSeenInterval {
+		configs.DB.Model(&models.UserLogin{}).Where("id = ?", session.ID).Update("last_seen_at", time.Now())
+	}
+
 	c.Locals("userId", validToken.UserId)
+	c.Locals("account", account)
+	c.Locals("sessionId", validToken.SessionId)
 	c.Locals("email", validToken.Email)
 	c.Locals("mobile", validToken.Mobile)
+	c.Locals("roles", validToken.Roles)
+	c.Locals("permissions", validToken.Permissions)
 
 	return c.Next()
 
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole lets the request through when the account has any of the roles. It has to run
+// after IsAuthenticated.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, _ := c.Locals("roles").([]string)
+
+		for _, role := range roles {
+			if slices.Contains(granted, role) {
+				return c.Next()
+			}
+		}
+
+		return forbidden(c)
+	}
+}
+
+// RequirePermission lets the request through when the account has all of the permissions. It has
+// to run after IsAuthenticated.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, _ := c.Locals("permissions").([]string)
+
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				return forbidden(c)
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+func forbidden(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": "You are not allowed to do this",
+		"success": false,
+	})
+}
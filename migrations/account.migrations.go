@@ -0,0 +1,15 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// CreateProviderIdIndexes makes Google and Apple ids unique. The columns default to an empty
+// string, so only filled in ids are indexed.
+func CreateProviderIdIndexes(db *gorm.DB) error {
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_google_id ON accounts (google_id) WHERE google_id <> ''").Error; err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_apple_id ON accounts (apple_id) WHERE apple_id <> ''").Error
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// appendOnlyTables maps the history tables to the columns with personal data. Blanking those is the one
+// change allowed, so a deleted account's history can be anonymized.
+var appendOnlyTables = map[string][]string{
+	"account_block_events": {"notes"},
+	"auth_events":          {"ip", "user_agent", "fcm"},
+}
+
+// ProtectAppendOnlyTables makes the database reject updates and deletes on history tables, so
+// entries can't be changed even by mistake.
+func ProtectAppendOnlyTables(db *gorm.DB) error {
+	err := db.Exec(`CREATE OR REPLACE FUNCTION reject_append_only_change() RETURNS trigger AS $$
+BEGIN
+	-- The trigger arguments name the columns that may be blanked, nothing else may change
+	IF TG_OP = 'UPDATE'
+		AND to_jsonb(NEW) - TG_ARGV = to_jsonb(OLD) - TG_ARGV
+		AND NOT EXISTS (SELECT 1 FROM jsonb_each_text(to_jsonb(NEW)) WHERE key = ANY(TG_ARGV) AND value <> '') THEN
+		RETURN NEW;
+	END IF;
+
+	RAISE EXCEPTION '% is append only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql`).Error
+
+	if err != nil {
+		return err
+	}
+
+	for table, columns := range appendOnlyTables {
+		if err := db.Exec("DROP TRIGGER IF EXISTS " + table + "_append_only ON " + table).Error; err != nil {
+			return err
+		}
+
+		err := db.Exec("CREATE TRIGGER " + table + "_append_only BEFORE UPDATE OR DELETE ON " + table + " FOR EACH ROW EXECUTE FUNCTION reject_append_only_change('" + strings.Join(columns, "', '") + "')").Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"ecommerce/configs"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Run applies the data migrations that AutoMigrate cannot express. Each step has to be
+// safe to run on every startup.
+func Run(db *gorm.DB, env configs.EnvConfig) error {
+	log.Println("Running Data Migrations")
+
+	if err := HashPlaintextOtps(db); err != nil {
+		return err
+	}
+
+	if err := DropSingleOtpConstraint(db); err != nil {
+		return err
+	}
+
+	if err := DropSharedEmailOtps(db); err != nil {
+		return err
+	}
+
+	if err := HashStoredRefreshTokens(db); err != nil {
+		return err
+	}
+
+	if err := ReplaceUniqueDeviceIndex(db); err != nil {
+		return err
+	}
+
+	if err := CreateProviderIdIndexes(db); err != nil {
+		return err
+	}
+
+	if err := NormalizePhoneNumbers(db); err != nil {
+		return err
+	}
+
+	if err := ResealTwoFactorSecrets(db); err != nil {
+		return err
+	}
+
+	if err := SeedRoles(db); err != nil {
+		return err
+	}
+
+	if err := GrantBootstrapAdmins(db, env.ADMIN_ACCOUNT_IDS); err != nil {
+		return err
+	}
+
+	if err := ProtectAppendOnlyTables(db); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// HashPlaintextOtps replaces codes stored before hashing was introduced with their hash,
+// so codes that were already sent keep working.
+func HashPlaintextOtps(db *gorm.DB) error {
+	var otps []models.UserOtp
+
+	if err := db.Select("id", "otp").Where("otp <> '' AND otp NOT LIKE ?", "v1$%").Find(&otps).Error; err != nil {
+		return err
+	}
+
+	for _, userOtp := range otps {
+		if helpers.IsHashedOtp(userOtp.Otp) {
+			continue
+		}
+
+		otpHash, err := helpers.HashOtp(userOtp.Otp)
+
+		if err != nil {
+			return err
+		}
+
+		// Only overwrite the code we read, a new one may have been issued meanwhile
+		err = db.Model(&models.UserOtp{}).Where("id = ? AND otp = ?", userOtp.ID, userOtp.Otp).Update("otp", otpHash).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(otps) > 0 {
+		log.Printf("Hashed %d plaintext OTPs", len(otps))
+	}
+
+	return nil
+}
+
+// DropSingleOtpConstraint removes the old one-code-per-account constraint. Codes are unique per
+// account and channel now, which AutoMigrate adds as idx_user_otp_channel.
+func DropSingleOtpConstraint(db *gorm.DB) error {
+	for _, constraint := range []string{"uni_user_otps_account_id", "user_otps_account_id_key"} {
+		if err := db.Exec("ALTER TABLE user_otps DROP CONSTRAINT IF EXISTS " + constraint).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DropSharedEmailOtps deletes the codes stored under the old shared email channel. Sign in links and
+// re-authentication codes have their own channels now, an outstanding code only has to be requested again.
+func DropSharedEmailOtps(db *gorm.DB) error {
+	return db.Where("channel = ?", models.OtpChannelEmail).Delete(&models.UserOtp{}).Error
+}
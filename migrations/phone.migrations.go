@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"errors"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// NormalizePhoneNumbers rewrites mobile numbers stored before E.164 normalization, using the country
+// code stored next to them. Numbers that can't be parsed or that would collide with another account
+// are left alone and logged for manual review.
+func NormalizePhoneNumbers(db *gorm.DB) error {
+	var accounts []models.Account
+
+	if err := db.Select("id", "mobile", "country_code").Where("mobile IS NOT NULL AND mobile <> '' AND mobile NOT LIKE ?", "+%").Find(&accounts).Error; err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		phone, err := helpers.ParsePhone(account.Mobile, account.CountryCode)
+
+		if err != nil {
+			log.Printf("Skipping mobile of account %s: %v", account.ID, err)
+			continue
+		}
+
+		err = db.Model(&models.Account{}).Where("id = ? AND mobile = ?", account.ID, account.Mobile).Updates(map[string]interface{}{
+			"mobile":       phone.E164(),
+			"country_code": phone.CountryCode,
+		}).Error
+
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			log.Printf("Skipping mobile of account %s: %s belongs to another account", account.ID, phone.E164())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var addresses []models.Address
+
+	if err := db.Select("id", "phone_number", "country_code").Where("phone_number <> '' AND phone_number NOT LIKE ?", "+%").Find(&addresses).Error; err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		phone, err := helpers.ParsePhone(address.PhoneNumber, address.CountryCode)
+
+		if err != nil {
+			log.Printf("Skipping phone number of address %s: %v", address.ID, err)
+			continue
+		}
+
+		err = db.Model(&models.Address{}).Where("id = ? AND phone_number = ?", address.ID, address.PhoneNumber).Updates(map[string]interface{}{
+			"phone_number": phone.E164(),
+			"country_code": phone.CountryCode,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(accounts)+len(addresses) > 0 {
+		log.Printf("Normalized phone numbers of %d accounts and %d addresses", len(accounts), len(addresses))
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"ecommerce/models"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeedRoles creates the built in roles and permissions and makes sure every role has at least its
+// default permissions. Permissions granted by hand are kept.
+func SeedRoles(db *gorm.DB) error {
+	for roleName, permissionNames := range models.DefaultRolePermissions {
+		role := models.Role{}
+
+		if err := db.Where(models.Role{Name: roleName}).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+
+		permissions := make([]models.Permission, 0, len(permissionNames))
+
+		for _, permissionName := range permissionNames {
+			permission := models.Permission{}
+
+			if err := db.Where(models.Permission{Name: permissionName}).FirstOrCreate(&permission).Error; err != nil {
+				return err
+			}
+
+			permissions = append(permissions, permission)
+		}
+
+		if err := db.Model(&role).Association("Permissions").Append(permissions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GrantBootstrapAdmins gives the admin role to the accounts in ADMIN_ACCOUNT_IDS, so the first admin
+// can grant roles through the API.
+func GrantBootstrapAdmins(db *gorm.DB, adminAccountIds string) error {
+	adminRole := models.Role{}
+
+	if err := db.First(&adminRole, "name = ?", models.RoleAdmin).Error; err != nil {
+		return err
+	}
+
+	for _, accountId := range strings.Split(adminAccountIds, ",") {
+		accountId = strings.TrimSpace(accountId)
+
+		if accountId == "" {
+			continue
+		}
+
+		var accountExist int64
+		if err := db.Model(&models.Account{}).Where("id = ?", accountId).Count(&accountExist).Error; err != nil {
+			return err
+		}
+
+		if accountExist == 0 {
+			log.Printf("Skipping admin grant, account %s does not exist", accountId)
+			continue
+		}
+
+		err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.AccountRole{AccountID: accountId, RoleID: adminRole.ID}).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// HashStoredRefreshTokens replaces refresh tokens stored in full with their SHA-256, which is what
+// the refresh endpoint compares against. Raw JWTs are recognised by their dots.
+func HashStoredRefreshTokens(db *gorm.DB) error {
+	return db.Exec("UPDATE user_logins SET refresh_token = encode(sha256(refresh_token::bytea), 'hex') WHERE refresh_token LIKE '%.%'").Error
+}
+
+// ReplaceUniqueDeviceIndex drops the old unique index on device and refresh token. Every login has its
+// own row now, so a device has many, and rows start without a token. Only tokens that were issued have
+// to be unique.
+func ReplaceUniqueDeviceIndex(db *gorm.DB) error {
+	if err := db.Exec("DROP INDEX IF EXISTS idx_unique_device").Error; err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_logins_refresh_token ON user_logins (refresh_token) WHERE refresh_token <> ''").Error
+}
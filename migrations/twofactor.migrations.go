@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"ecommerce/helpers"
+	"ecommerce/models"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// ResealTwoFactorSecrets moves TOTP secrets sealed before TWO_FACTOR_SECRET existed to the new key.
+// Secrets that open with neither key are left alone so the owner can still reset 2FA.
+func ResealTwoFactorSecrets(db *gorm.DB) error {
+	var rows []models.AccountTwoFactor
+
+	if err := db.Select("id", "secret").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	resealed := 0
+
+	for _, row := range rows {
+		secret, changed, err := helpers.ResealSecret(row.Secret)
+
+		if err != nil {
+			log.Printf("Could not reseal the 2FA secret %d: %v", row.ID, err)
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		// Only overwrite the secret we read, it may have been replaced meanwhile
+		err = db.Model(&models.AccountTwoFactor{}).Where("id = ? AND secret = ?", row.ID, row.Secret).Update("secret", secret).Error
+
+		if err != nil {
+			return err
+		}
+
+		resealed++
+	}
+
+	if resealed > 0 {
+		log.Printf("Resealed %d 2FA secrets", resealed)
+	}
+
+	return nil
+}
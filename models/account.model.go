@@ -8,12 +8,16 @@ type Account struct {
 	ID                  string    `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
 	Name                string    `gorm:"type:varchar(100)" json:"name"`
 	Email               string    `gorm:"type:varchar(50);unique;default:null" json:"email"`
-	Mobile              string    `gorm:"type:varchar(30);unique;not null" json:"mobile"`
-	Password            string    `gorm:"type:varchar(500)" json:"password"`
+	PendingEmail        string    `gorm:"type:varchar(50)" json:"pending_email"`              // replaces Email once the verification link is clicked
+	Mobile              string    `gorm:"type:varchar(30);unique;default:null" json:"mobile"` // empty for accounts created through Google or Apple sign in
+	Password            string    `gorm:"type:varchar(500)" json:"-"`                         // bcrypt hash, empty until the user sets a password
+	PasswordChangedAt   time.Time `gorm:"type:timestamp" json:"-"`
 	IsBlocked           bool      `gorm:"type:boolean;default:false" json:"is_blocked"`
 	IsBlacklisted       bool      `gorm:"type:boolean;default:false" json:"is_blacklisted"`
 	IsBlockedReason     string    `gorm:"type:varchar(30)" json:"is_blocked_reason"`
 	IsBlacklistedReason string    `gorm:"type:varchar(30)" json:"is_blacklisted_reason"`
+	BlockedUntil        time.Time `gorm:"type:timestamp" json:"blocked_until"`     // zero for blocks without an expiry
+	BlacklistedUntil    time.Time `gorm:"type:timestamp" json:"blacklisted_until"` // zero for blacklistings without an expiry
 	Lang                string    `gorm:"type:varchar(10);default:'en'" json:"lang"`
 	CountryCode         string    `gorm:"type:varchar(10);default:'+91'" json:"country_code"`
 	Lat                 float64   `gorm:"type:float" json:"lat"`
@@ -21,9 +25,34 @@ type Account struct {
 	IsLoggedIn          bool      `gorm:"type:boolean;default:false" json:"is_logged_in"`
 	IsMobileVerified    bool      `gorm:"type:bool;default:false" json:"is_mobile_verified"`
 	IsEmailVerified     bool      `gorm:"type:bool;default:false" json:"is_email_verified"`
-	GoogleID            string    `gorm:"type:varchar(30)" json:"google_id"`
-	AppleID             string    `gorm:"type:varchar(30)" json:"apple_id"`
-	ProfileImage        string    `gorm:"type:varchar(30)" json:"profile_image"`
+	GoogleID            string    `gorm:"type:varchar(255)" json:"google_id"`
+	AppleID             string    `gorm:"type:varchar(255)" json:"apple_id"`
+	ProfileImage        string    `gorm:"type:varchar(255)" json:"profile_image"` // storage key of the original upload
+	DeletionRequestedAt time.Time `gorm:"type:timestamp" json:"deletion_requested_at"`
+	DeletionScheduledAt time.Time `gorm:"type:timestamp" json:"deletion_scheduled_at"`  // zero unless the user asked for deletion, cancelling resets it
+	IsDeleted           bool      `gorm:"type:boolean;default:false" json:"is_deleted"` // the row stays for order history, its PII is anonymized
+	DeletedAt           time.Time `gorm:"type:timestamp" json:"deleted_at"`
 	CreatedAt           time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
 	UpdatedAt           time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
 }
+
+// IsVerified reports whether the account proved who it belongs to, either through the mobile OTP
+// or through a Google or Apple sign in.
+func (a *Account) IsVerified() bool {
+	return a.IsMobileVerified || a.GoogleID != "" || a.AppleID != ""
+}
+
+// BlockActive reports whether the account is blocked right now. Blocks with an expiry lift by themselves.
+func (a *Account) BlockActive() bool {
+	return a.IsBlocked && (a.BlockedUntil.IsZero() || time.Now().Before(a.BlockedUntil))
+}
+
+// BlacklistActive reports whether the account is blacklisted right now.
+func (a *Account) BlacklistActive() bool {
+	return a.IsBlacklisted && (a.BlacklistedUntil.IsZero() || time.Now().Before(a.BlacklistedUntil))
+}
+
+// DeletionPending reports whether the account is scheduled for deletion and can still be kept.
+func (a *Account) DeletionPending() bool {
+	return !a.IsDeleted && !a.DeletionScheduledAt.IsZero()
+}
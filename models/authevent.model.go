@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Auth event types recorded in the security history.
+const (
+	AuthEventRegister     = "register"
+	AuthEventOtpSent      = "otp_sent"
+	AuthEventOtpFailed    = "otp_failed"
+	AuthEventLogin        = "login"
+	AuthEventLoginFailed  = "login_failed"
+	AuthEventTokenRefresh = "token_refresh"
+	AuthEventLogout       = "logout"
+	AuthEventEmailChange  = "email_change"
+	AuthEventBlock        = "block"
+	AuthEventDeletion     = "account_deletion"
+)
+
+// AuthEvent is one entry of an account's security history. IP and user agent are those of the request
+// that caused the event, platform and FCM come from the session it belongs to. Like the block history
+// the table is append only and the account is not a foreign key.
+type AuthEvent struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID string    `gorm:"type:uuid;not null;index:idx_auth_event_account" json:"account_id"`
+	Type      string    `gorm:"type:varchar(30);not null;index" json:"type"`
+	Detail    string    `gorm:"type:varchar(100)" json:"detail"`
+	SessionID int       `gorm:"default:null" json:"session_id"`
+	ActorID   string    `gorm:"type:uuid;default:null" json:"actor_id"` // admin who caused the event, empty for the account's own actions
+	IP        string    `gorm:"type:varchar(45)" json:"ip"`
+	UserAgent string    `gorm:"type:varchar(255)" json:"user_agent"`
+	Platform  string    `gorm:"type:varchar(30)" json:"platform"`
+	FCM       string    `gorm:"type:varchar(50)" json:"fcm"`
+	CreatedAt time.Time `gorm:"type:timestamp;default:current_timestamp;index:idx_auth_event_account;index" json:"created_at"`
+}
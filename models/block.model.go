@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Block actions recorded in the block history.
+const (
+	BlockActionBlock     = "block"
+	BlockActionBlacklist = "blacklist"
+	BlockActionUnblock   = "unblock"
+)
+
+// AccountBlockEvent is one entry of an account's block history. Rows are never updated or deleted,
+// a trigger rejects both. The account is not a foreign key so that history outlives the account.
+type AccountBlockEvent struct {
+	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID   string    `gorm:"type:uuid;not null;index" json:"account_id"`
+	Action      string    `gorm:"type:varchar(20);not null" json:"action"`
+	ReasonCode  string    `gorm:"type:varchar(30)" json:"reason_code"`
+	Notes       string    `gorm:"type:text" json:"notes"`
+	ExpiresAt   time.Time `gorm:"type:timestamp" json:"expires_at"` // zero when the action has no expiry
+	PerformedBy string    `gorm:"type:uuid;default:null" json:"performed_by"`
+	CreatedAt   time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// States of a DataExport.
+const (
+	DataExportPending  = "pending"
+	DataExportBuilding = "building"
+	DataExportReady    = "ready"
+	DataExportFailed   = "failed"
+	DataExportExpired  = "expired"
+)
+
+// DataExport is a user's request for a copy of their data. The archive is built in the background
+// and removed again when the download link expires.
+type DataExport struct {
+	ID          string    `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	AccountID   string    `gorm:"type:uuid;not null;index" json:"account_id"`
+	Account     Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"-"`
+	Status      string    `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	FilePath    string    `gorm:"type:varchar(255)" json:"-"`
+	Size        int64     `gorm:"type:bigint;default:0" json:"size"`
+	CompletedAt time.Time `gorm:"type:timestamp" json:"completed_at"`
+	ExpiresAt   time.Time `gorm:"type:timestamp" json:"expires_at"` // the archive and its link are gone afterwards
+	CreatedAt   time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
+}
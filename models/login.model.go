@@ -6,15 +6,16 @@ import (
 
 type UserLogin struct {
 	ID           int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	AccountID    string    `gorm:"type:uuid;not null uniqueIndex:idx_unique_device" json:"account_id"`
+	AccountID    string    `gorm:"type:uuid;not null;index" json:"account_id"`
 	Account      Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"account"`
-	FCM          string    `gorm:"type:varchar(50);uniqueIndex:idx_unique_device" json:"fcm"`
+	FCM          string    `gorm:"type:varchar(50)" json:"fcm"`
 	DeviceName   string    `gorm:"type:varchar(30)" json:"device_name"`
 	Lang         string    `gorm:"type:varchar(10);default:'en'" json:"lang"`
-	RefreshToken string    `gorm:"type:varchar(500);uniqueIndex:idx_unique_device" json:"refresh_token"`
+	RefreshToken string    `gorm:"type:varchar(500)" json:"-"` // SHA-256 of the current refresh token, unique once set
 	Platform     string    `gorm:"type:varchar(30)" json:"platform"`
-	IsExpired    time.Time `gorm:"type:timestamp" json:"is_expired"`
+	IsExpired    time.Time `gorm:"type:timestamp" json:"is_expired"` // when the current refresh token expires
 	IsActive     bool      `gorm:"type:bool;default:true" json:"is_active"`
+	LastSeenAt   time.Time `gorm:"type:timestamp" json:"last_seen_at"`
 	CreatedAt    time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
 	UpdatedAt    time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// MobileChangeRequest is a pending change of an account's mobile number. It holds the code sent to
+// the new number and, unless the user re-authenticated, the code sent to the old one.
+type MobileChangeRequest struct {
+	ID             int     `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID      string  `gorm:"type:uuid;not null;unique" json:"account_id"`
+	Account        Account `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"account"`
+	NewMobile      string  `gorm:"type:varchar(30);not null" json:"new_mobile"`
+	NewCountryCode string  `gorm:"type:varchar(10);not null" json:"new_country_code"`
+	NewOtp         string  `gorm:"type:varchar(150);not null" json:"-"`
+	OldOtp         string  `gorm:"type:varchar(150)" json:"-"` // empty when the old number does not have to confirm
+	OtpThrottle
+	ExpiredAt time.Time `gorm:"type:timestamp" json:"expired_at"`
+	CreatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
+}
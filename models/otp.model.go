@@ -4,13 +4,38 @@ import (
 	"time"
 )
 
+// Channels a code is delivered through.
+const (
+	OtpChannelSms   = "sms"
+	OtpChannelEmail = "email"
+)
+
+// Email codes are stored per purpose, so a sign in link and a re-authentication code never replace or
+// stand in for each other.
+const (
+	OtpChannelEmailLogin  = "email_login"
+	OtpChannelEmailReauth = "email_reauth"
+)
+
 type UserOtp struct {
 	ID              int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	AccountID       string    `gorm:"type:uuid;not null;unique" json:"account_id"`
+	AccountID       string    `gorm:"type:uuid;not null;uniqueIndex:idx_user_otp_channel" json:"account_id"`
+	Channel         string    `gorm:"type:varchar(20);not null;default:'sms';uniqueIndex:idx_user_otp_channel" json:"channel"` // every channel has its own current code
 	Account         Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"account"`
-	Otp             string    `gorm:"type:varchar(10);not null" json:"otp"`
+	Otp             string    `gorm:"type:varchar(150);not null" json:"-"` // salted HMAC of the code, never the code itself
 	IsExpired       bool      `gorm:"type:boolean;default:false" json:"is_expired"`
 	ExpiredDateTime time.Time `gorm:"type:timestamp" json:"expired_date_time"`
-	CreatedAt       time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
-	UpdatedAt       time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
+	OtpThrottle
+	CreatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
+}
+
+// OtpThrottle holds the resend and guess counters of a stored code, see helpers.CheckOTPSend. Every row
+// that holds codes embeds it.
+type OtpThrottle struct {
+	Attempts     int       `gorm:"type:int;default:0" json:"attempts"`
+	SendCount    int       `gorm:"type:int;default:0" json:"send_count"`
+	SendWindowAt time.Time `gorm:"type:timestamp" json:"send_window_at"`
+	LastSentAt   time.Time `gorm:"type:timestamp" json:"last_sent_at"`
+	LockedUntil  time.Time `gorm:"type:timestamp" json:"locked_until"`
 }
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+)
+
+// Channels notifications are delivered through.
+const (
+	NotificationChannelSms   = "sms"
+	NotificationChannelEmail = "email"
+	NotificationChannelPush  = "push"
+)
+
+// Categories of notifications, every channel is opted in or out per category.
+const (
+	NotificationCategorySecurity     = "security"
+	NotificationCategoryOrderUpdates = "order_updates"
+	NotificationCategoryPromotions   = "promotions"
+)
+
+// AccountPreference holds the settings of an account. Accounts without a row use DefaultPreferences.
+type AccountPreference struct {
+	AccountID                   string    `gorm:"type:uuid;primaryKey" json:"account_id"`
+	Account                     Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"-"`
+	SmsSecurity                 bool      `gorm:"type:boolean" json:"sms_security"`
+	SmsOrderUpdates             bool      `gorm:"type:boolean" json:"sms_order_updates"`
+	SmsPromotions               bool      `gorm:"type:boolean" json:"sms_promotions"`
+	EmailSecurity               bool      `gorm:"type:boolean" json:"email_security"`
+	EmailOrderUpdates           bool      `gorm:"type:boolean" json:"email_order_updates"`
+	EmailPromotions             bool      `gorm:"type:boolean" json:"email_promotions"`
+	PushSecurity                bool      `gorm:"type:boolean" json:"push_security"`
+	PushOrderUpdates            bool      `gorm:"type:boolean" json:"push_order_updates"`
+	PushPromotions              bool      `gorm:"type:boolean" json:"push_promotions"`
+	Currency                    string    `gorm:"type:varchar(3);not null" json:"currency"`  // ISO 4217 code
+	Timezone                    string    `gorm:"type:varchar(64);not null" json:"timezone"` // IANA name, times in notifications are shown in it
+	MarketingConsent            bool      `gorm:"type:boolean" json:"marketing_consent"`     // promotions are only sent while it is given
+	MarketingConsentAt          time.Time `gorm:"type:timestamp" json:"marketing_consent_at"`
+	MarketingConsentWithdrawnAt time.Time `gorm:"type:timestamp" json:"marketing_consent_withdrawn_at"`
+	CreatedAt                   time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+	UpdatedAt                   time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
+}
+
+// DefaultPreferences are the settings of an account that never changed them. The booleans have no
+// column defaults on purpose, gorm would replace a false with the default on insert.
+func DefaultPreferences(accountId string) AccountPreference {
+	return AccountPreference{
+		AccountID:         accountId,
+		SmsSecurity:       true,
+		SmsOrderUpdates:   true,
+		EmailSecurity:     true,
+		EmailOrderUpdates: true,
+		PushSecurity:      true,
+		PushOrderUpdates:  true,
+		Currency:          "INR",
+		Timezone:          "Asia/Kolkata",
+	}
+}
+
+// Opted returns the opt-in of the channel for the category, nil for unknown combinations.
+func (p *AccountPreference) Opted(channel string, category string) *bool {
+	optIns := map[string]map[string]*bool{
+		NotificationChannelSms: {
+			NotificationCategorySecurity:     &p.SmsSecurity,
+			NotificationCategoryOrderUpdates: &p.SmsOrderUpdates,
+			NotificationCategoryPromotions:   &p.SmsPromotions,
+		},
+		NotificationChannelEmail: {
+			NotificationCategorySecurity:     &p.EmailSecurity,
+			NotificationCategoryOrderUpdates: &p.EmailOrderUpdates,
+			NotificationCategoryPromotions:   &p.EmailPromotions,
+		},
+		NotificationChannelPush: {
+			NotificationCategorySecurity:     &p.PushSecurity,
+			NotificationCategoryOrderUpdates: &p.PushOrderUpdates,
+			NotificationCategoryPromotions:   &p.PushPromotions,
+		},
+	}
+
+	return optIns[channel][category]
+}
+
+// Allows reports whether a notification of the category may be sent through the channel.
+func (p *AccountPreference) Allows(channel string, category string) bool {
+	opted := p.Opted(channel, category)
+
+	if opted == nil || !*opted {
+		return false
+	}
+
+	return category != NotificationCategoryPromotions || p.MarketingConsent
+}
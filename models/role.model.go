@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// Roles that are seeded on startup.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleSeller  = "seller"
+)
+
+// Permissions that are seeded on startup. Routes check permissions rather than roles where they can.
+const (
+	PermissionRolesManage    = "roles.manage"
+	PermissionAccountsRead   = "accounts.read"
+	PermissionAccountsManage = "accounts.manage"
+	PermissionProductsManage = "products.manage"
+)
+
+// DefaultRolePermissions is what every seeded role is granted.
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin:   {PermissionRolesManage, PermissionAccountsRead, PermissionAccountsManage, PermissionProductsManage},
+	RoleSupport: {PermissionAccountsRead},
+	RoleSeller:  {PermissionProductsManage},
+}
+
+type Role struct {
+	ID          int          `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string       `gorm:"type:varchar(30);not null;unique" json:"name"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt   time.Time    `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+}
+
+type Permission struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string    `gorm:"type:varchar(50);not null;unique" json:"name"`
+	CreatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+}
+
+type AccountRole struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID string    `gorm:"type:uuid;not null;uniqueIndex:idx_account_role" json:"account_id"`
+	Account   Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"-"`
+	RoleID    int       `gorm:"not null;uniqueIndex:idx_account_role" json:"role_id"`
+	Role      Role      `gorm:"foreignKey:RoleID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"role"`
+	GrantedBy string    `gorm:"type:uuid;default:null" json:"granted_by"` // empty for roles granted on startup
+	CreatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+}
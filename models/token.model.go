@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// UsedToken records the jti of a single use token once it has been accepted. Rows can go after
+// ExpiresAt, the token itself is rejected by then.
+type UsedToken struct {
+	TokenID   string    `gorm:"type:varchar(64);primaryKey" json:"token_id"`
+	AccountID string    `gorm:"type:uuid;not null;index" json:"account_id"`
+	Account   Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"account"`
+	Type      string    `gorm:"type:varchar(30);not null" json:"type"`
+	ExpiresAt time.Time `gorm:"type:timestamp;not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+}
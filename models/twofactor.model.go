@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+type AccountTwoFactor struct {
+	ID           int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID    string    `gorm:"type:uuid;not null;unique" json:"account_id"`
+	Account      Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"account"`
+	Secret       string    `gorm:"type:varchar(200);not null" json:"-"` // AES-GCM sealed TOTP secret
+	IsEnabled    bool      `gorm:"type:boolean;default:false" json:"is_enabled"`
+	EnabledAt    time.Time `gorm:"type:timestamp" json:"enabled_at"`
+	LastUsedStep int64     `gorm:"type:bigint;default:0" json:"-"` // TOTP step of the last accepted code
+	CreatedAt    time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"type:timestamp;default:current_timestamp" json:"updated_at"`
+}
+
+type TwoFactorRecoveryCode struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID string    `gorm:"type:uuid;not null;index" json:"account_id"`
+	Account   Account   `gorm:"foreignKey:AccountID;references:ID;constraint:OnUpdate:NO ACTION,OnDelete:CASCADE" json:"account"`
+	CodeHash  string    `gorm:"type:varchar(150);not null" json:"-"`
+	IsUsed    bool      `gorm:"type:boolean;default:false" json:"is_used"`
+	UsedAt    time.Time `gorm:"type:timestamp" json:"used_at"`
+	CreatedAt time.Time `gorm:"type:timestamp;default:current_timestamp" json:"created_at"`
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"ecommerce/controllers"
 	routes_v1 "ecommerce/routes/v1"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,6 +17,9 @@ func InitRoutes(app *fiber.App) error {
 		})
 	})
 
+	// Public keys so other services can verify our tokens
+	app.Get("/.well-known/jwks.json", controllers.GetJWKS)
+
 	api := app.Group("/api")
 	v1 := api.Group("/v1", func(c *fiber.Ctx) error {
 		c.Set("API-Version", "v1")
@@ -26,6 +30,11 @@ func InitRoutes(app *fiber.App) error {
 	routes_v1.InitAuthRoutes(userRoute.Group("/auth"))
 	routes_v1.InitProfileRoutes(userRoute.Group("/profile"))
 	routes_v1.InitAddressRoutes(userRoute.Group("/address"))
+	routes_v1.InitSessionRoutes(userRoute.Group("/sessions"))
+
+	routes_v1.InitAdminRoutes(v1.Group("/admin")) //api/v1/admin
+
+	routes_v1.InitFileRoutes(v1.Group("/files")) //api/v1/files
 
 	return nil
 }
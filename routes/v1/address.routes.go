@@ -10,6 +10,7 @@ import (
 func InitAddressRoutes(router fiber.Router) {
 	router.Post("/", middlewares.IsAuthenticated, controllers.AddAddress)
 	router.Put("/:addressId", middlewares.IsAuthenticated, controllers.UpdateAddress)
+	router.Patch("/:addressId", middlewares.IsAuthenticated, controllers.PatchAddress)
 	router.Delete("/:addressId", middlewares.IsAuthenticated, controllers.DeleteAddress)
 	router.Get("/", middlewares.IsAuthenticated, controllers.GetAllAddresses)
 }
@@ -0,0 +1,25 @@
+package routes_v1
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middlewares"
+	"ecommerce/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func InitAdminRoutes(router fiber.Router) {
+	router.Use(middlewares.IsAuthenticated)
+
+	router.Get("/roles", middlewares.RequirePermission(models.PermissionRolesManage), controllers.GetRoles)
+	router.Get("/accounts/:accountId/roles", middlewares.RequirePermission(models.PermissionRolesManage), controllers.GetAccountRoles)
+	router.Post("/accounts/:accountId/roles", middlewares.RequirePermission(models.PermissionRolesManage), controllers.GrantRole)
+	router.Delete("/accounts/:accountId/roles/:role", middlewares.RequirePermission(models.PermissionRolesManage), controllers.RevokeRole)
+
+	router.Post("/accounts/:accountId/block", middlewares.RequirePermission(models.PermissionAccountsManage), controllers.BlockAccount)
+	router.Post("/accounts/:accountId/blacklist", middlewares.RequirePermission(models.PermissionAccountsManage), controllers.BlacklistAccount)
+	router.Post("/accounts/:accountId/unblock", middlewares.RequirePermission(models.PermissionAccountsManage), controllers.UnblockAccount)
+	router.Get("/accounts/:accountId/block-history", middlewares.RequirePermission(models.PermissionAccountsRead), controllers.GetBlockHistory)
+
+	router.Get("/auth-events", middlewares.RequirePermission(models.PermissionAccountsRead), controllers.SearchAuthEvents)
+}
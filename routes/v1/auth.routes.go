@@ -14,5 +14,14 @@ func InitAuthRoutes(router fiber.Router) {
 	router.Post("/login", controllers.Login)
 	router.Post("/login-verify", controllers.LoginVerifyOTP)
 	router.Get("/generate-token", controllers.GenerateToken)
+	router.Post("/generate-token", controllers.GenerateToken)
+	router.Post("/login-password", controllers.PasswordLogin)
+	router.Post("/login-2fa", controllers.TwoFactorLogin)
+	router.Post("/login-email", controllers.EmailLogin)
+	router.Post("/login-email-verify", controllers.EmailLoginVerify)
+	router.Post("/forgot-password", controllers.ForgotPassword)
+	router.Post("/reset-password", controllers.ResetPassword)
+	router.Post("/oauth/google", controllers.GoogleLogin)
+	router.Post("/oauth/apple", controllers.AppleLogin)
 	router.Put("/logout", middlewares.IsAuthenticated, controllers.LogoutUser)
 }
@@ -0,0 +1,11 @@
+package routes_v1
+
+import (
+	"ecommerce/controllers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func InitFileRoutes(router fiber.Router) {
+	router.Get("/*", controllers.ServeFile) // signed links handed out by the local storage driver
+}
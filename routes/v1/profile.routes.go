@@ -10,6 +10,28 @@ import (
 func InitProfileRoutes(router fiber.Router) {
 	router.Get("/", middlewares.IsAuthenticated, controllers.GetProfile)
 	router.Put("/", middlewares.IsAuthenticated, controllers.UpdateProfile)
+	router.Patch("/", middlewares.IsAuthenticated, controllers.PatchProfile)
+	router.Get("/preferences", middlewares.IsAuthenticated, controllers.GetPreferences)
+	router.Put("/preferences", middlewares.IsAuthenticated, controllers.UpdatePreferences)
+	router.Post("/image", middlewares.IsAuthenticated, controllers.UploadProfileImage)
+	router.Delete("/image", middlewares.IsAuthenticated, controllers.DeleteProfileImage)
+	router.Post("/password/otp", middlewares.IsAuthenticated, controllers.RequestSetPasswordOtp)
+	router.Put("/password", middlewares.IsAuthenticated, controllers.SetPassword)
+	router.Put("/change-password", middlewares.IsAuthenticated, controllers.ChangePassword)
+	router.Get("/2fa", middlewares.IsAuthenticated, controllers.GetTwoFactorStatus)
+	router.Post("/2fa/enroll", middlewares.IsAuthenticated, controllers.EnrollTwoFactor)
+	router.Post("/2fa/confirm", middlewares.IsAuthenticated, controllers.ConfirmTwoFactor)
+	router.Post("/2fa/disable", middlewares.IsAuthenticated, controllers.DisableTwoFactor)
+	router.Post("/2fa/recovery-codes", middlewares.IsAuthenticated, controllers.RegenerateRecoveryCodes)
+	router.Post("/mobile", middlewares.IsAuthenticated, controllers.ChangeMobile)
+	router.Post("/mobile/verify", middlewares.IsAuthenticated, controllers.ConfirmMobileChange)
+	router.Post("/delete", middlewares.IsAuthenticated, controllers.RequestAccountDeletion)
+	router.Post("/delete/confirm", middlewares.IsAuthenticated, controllers.ConfirmAccountDeletion)
+	router.Post("/delete/cancel", middlewares.IsAuthenticated, controllers.CancelAccountDeletion)
+	router.Post("/exports", middlewares.IsAuthenticated, controllers.RequestDataExport)
+	router.Get("/exports", middlewares.IsAuthenticated, controllers.GetDataExports)
+	router.Get("/exports/:exportId/download", controllers.DownloadDataExport) // signed link from the email, no login needed
+	router.Get("/security-events", middlewares.IsAuthenticated, controllers.GetSecurityEvents)
 	router.Put("/update-email", middlewares.IsAuthenticated, controllers.UpdateEmail)
 	router.Get("/verify-email", controllers.VerifyEmail) //This is get because user can verify by simply redirect to the browser
 }
@@ -0,0 +1,17 @@
+package routes_v1
+
+import (
+	"ecommerce/controllers"
+	"ecommerce/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func InitSessionRoutes(router fiber.Router) {
+	router.Get("/", middlewares.IsAuthenticated, controllers.GetSessions)
+	router.Get("/revoke", controllers.RevokeSessionFromAlert) // opened from the link in the new device alert
+	router.Post("/revoke", controllers.ConfirmSessionRevokeFromAlert)
+	router.Delete("/others", middlewares.IsAuthenticated, controllers.RevokeOtherSessions)
+	router.Put("/:sessionId", middlewares.IsAuthenticated, controllers.RenameSession)
+	router.Delete("/:sessionId", middlewares.IsAuthenticated, controllers.RevokeSession)
+}